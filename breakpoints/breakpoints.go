@@ -0,0 +1,156 @@
+// Package breakpoints keeps track of the debugger's breakpoints, which can be at an address or a label, and can have a condition.
+package breakpoints
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/thatoddmailbox/computer-emu/cpu"
+	"github.com/thatoddmailbox/computer-emu/symbols"
+)
+
+var ErrInvalidLocation = errors.New("breakpoints: invalid location")
+var ErrInvalidCondition = errors.New("breakpoints: invalid condition")
+
+// Breakpoint stops the cpu before it runs the instruction at Address, if Condition is true.
+type Breakpoint struct {
+	Address uint16
+
+	// empty if it always stops
+	Condition string
+
+	Enabled bool
+
+	// how many times it's stopped the cpu
+	Hits int
+
+	condition expression
+}
+
+// List is every breakpoint that's been set. Like the cpu, it should only be used while holding the cpu mutex.
+type List struct {
+	breakpoints []*Breakpoint
+
+	// whether any enabled breakpoint is at each address, so that most instructions only need one lookup
+	armed [0x10000]bool
+}
+
+func NewList() *List {
+	return &List{}
+}
+
+// parseLocation parses an address in hex, like 0x1234 or 1234, a label, or a label plus a hex offset, like loop+0x3
+func parseLocation(location string, s *symbols.Symbols) (uint16, bool) {
+	if address, ok := s.Resolve(location); ok {
+		return address, true
+	}
+
+	offset := uint64(0)
+	if plus := strings.Index(location, "+"); plus != -1 {
+		var err error
+		offset, err = strconv.ParseUint(strings.TrimPrefix(strings.ToLower(location[plus+1:]), "0x"), 16, 16)
+		if err != nil {
+			return 0, false
+		}
+		address, ok := s.Resolve(location[:plus])
+		return address + uint16(offset), ok
+	}
+
+	address, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(location), "0x"), 16, 16)
+	return uint16(address), err == nil
+}
+
+func (l *List) update() {
+	l.armed = [0x10000]bool{}
+	for _, breakpoint := range l.breakpoints {
+		if breakpoint.Enabled {
+			l.armed[breakpoint.Address] = true
+		}
+	}
+}
+
+// Add adds an enabled breakpoint at location, which is an address in hex or a label from s, which can be nil.
+// The condition can use registers, flags like zf and cf, memory like [0xF004], and labels, and can be empty.
+func (l *List) Add(location string, condition string, s *symbols.Symbols) (*Breakpoint, error) {
+	location = strings.TrimSpace(location)
+	address, ok := parseLocation(location, s)
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrInvalidLocation, location)
+	}
+
+	breakpoint := &Breakpoint{
+		Address:   address,
+		Condition: strings.TrimSpace(condition),
+		Enabled:   true,
+	}
+	if breakpoint.Condition != "" {
+		compiled, err := compile(breakpoint.Condition, s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCondition, err.Error())
+		}
+		breakpoint.condition = compiled
+	}
+
+	l.breakpoints = append(l.breakpoints, breakpoint)
+	l.update()
+	return breakpoint, nil
+}
+
+// Remove removes the breakpoint at index i in Breakpoints.
+func (l *List) Remove(i int) {
+	if i < 0 || i >= len(l.breakpoints) {
+		return
+	}
+	l.breakpoints = append(l.breakpoints[:i], l.breakpoints[i+1:]...)
+	l.update()
+}
+
+// Toggle enables or disables the breakpoint at index i in Breakpoints.
+func (l *List) Toggle(i int) {
+	if i < 0 || i >= len(l.breakpoints) {
+		return
+	}
+	l.breakpoints[i].Enabled = !l.breakpoints[i].Enabled
+	l.update()
+}
+
+// Breakpoints returns every breakpoint, in the order they were added.
+func (l *List) Breakpoints() []*Breakpoint {
+	return l.breakpoints
+}
+
+// Matches returns the enabled breakpoint that the cpu is stopped at with its condition true, or nil if there isn't one.
+// Conditions read memory without going through the bus's hooks, so checking them doesn't change anything.
+func (l *List) Matches(c *cpu.CPU) *Breakpoint {
+	if !l.armed[c.PC] {
+		return nil
+	}
+	for _, breakpoint := range l.breakpoints {
+		if !breakpoint.Enabled || breakpoint.Address != c.PC {
+			continue
+		}
+		if breakpoint.condition == nil || breakpoint.condition(c) != 0 {
+			return breakpoint
+		}
+	}
+	return nil
+}
+
+// Check is called before each instruction, returning the breakpoint that should stop the cpu, if there is one, and counting the hit.
+func (l *List) Check(c *cpu.CPU) *Breakpoint {
+	breakpoint := l.Matches(c)
+	if breakpoint != nil {
+		breakpoint.Hits += 1
+	}
+	return breakpoint
+}
+
+func (b *Breakpoint) String() string {
+	text := fmt.Sprintf("0x%04X", b.Address)
+	if b.Condition != "" {
+		text += " if " + b.Condition
+	}
+	return text
+}
@@ -0,0 +1,144 @@
+package breakpoints
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/thatoddmailbox/computer-emu/cpu"
+	"github.com/thatoddmailbox/computer-emu/devices"
+	"github.com/thatoddmailbox/computer-emu/symbols"
+)
+
+func testSymbols(t *testing.T) *symbols.Symbols {
+	table, err := symbols.ParseTable(strings.NewReader("loop: equ 0x0002\ncount: equ 0xF004\n"), "test.sym")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &symbols.Symbols{}
+	s.Add(table)
+	return s
+}
+
+func TestConditions(t *testing.T) {
+	c := &cpu.CPU{}
+	ram := devices.NewKR537RU2()
+	c.Bus.MemoryDevices = append(c.Bus.MemoryDevices, ram)
+	c.Bus.WriteMemoryByte(0xF004, 0x11)
+	c.Registers.A = 1
+	c.Registers.B = 2
+	c.Registers.H = 0xF0
+	c.Registers.L = 0x04
+	c.Registers.Flag = cpu.FlagZero
+	c.PC = 0x0003
+	s := testSymbols(t)
+
+	tests := []struct {
+		condition string
+		expected  int
+	}{
+		{"a + 1 == 2 && b", 1},
+		{"a + 1 == 2 && !b", 0},
+		{"a == 1 || b == 1 && a == 2", 1},
+		{"(a == 1 || b == 1) && a == 2", 0},
+		{"a + b * 0", -1},
+		{"b - a - 1", 0},
+		{"-a + 2", 1},
+		{"[0xF004] > 0x10", 1},
+		{"[hl] == 0x11", 1},
+		{"[count] & 0x10 == 0x10", 1},
+		{"[hl + 1]", 0},
+		{"zf && !cf", 1},
+		{"hl == count", 1},
+		{"pc == loop + 1", 1},
+		{"A == 1 && HL == $F004", 1},
+		{"a ^ 3 | 4", 6},
+	}
+	for _, test := range tests {
+		compiled, err := compile(test.condition, s)
+		if test.expected == -1 {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.condition)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.condition, err)
+			continue
+		}
+		result := compiled(c)
+		if result != test.expected {
+			t.Errorf("%s was %d, expected %d", test.condition, result, test.expected)
+		}
+	}
+}
+
+func TestConditionErrors(t *testing.T) {
+	s := testSymbols(t)
+	for _, condition := range []string{
+		"",
+		"a ==",
+		"(a == 1",
+		"a == 1)",
+		"[0xF004",
+		"0xF004]",
+		"[(a]",
+		"nowhere == 1",
+		"a == 1 b",
+		"a # 1",
+	} {
+		_, err := compile(condition, s)
+		if err == nil {
+			t.Errorf("%q: expected an error", condition)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	c := &cpu.CPU{}
+	s := testSymbols(t)
+	l := NewList()
+
+	_, err := l.Add("nowhere", "", s)
+	if !errors.Is(err, ErrInvalidLocation) {
+		t.Errorf("expected ErrInvalidLocation, got %v", err)
+	}
+	_, err = l.Add("loop", "a ==", s)
+	if !errors.Is(err, ErrInvalidCondition) {
+		t.Errorf("expected ErrInvalidCondition, got %v", err)
+	}
+
+	locations := map[string]uint16{"loop": 0x0002, "loop+0x3": 0x0005, "0x1a3f": 0x1A3F, "1A3F": 0x1A3F}
+	for location, expected := range locations {
+		breakpoint, err := l.Add(location, "", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if breakpoint.Address != expected {
+			t.Errorf("%s was at 0x%04X, expected 0x%04X", location, breakpoint.Address, expected)
+		}
+	}
+	for len(l.Breakpoints()) > 0 {
+		l.Remove(0)
+	}
+
+	conditional, err := l.Add("loop", "a == 3", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.PC = 0x0002
+	if l.Check(c) != nil {
+		t.Error("stopped with the condition false")
+	}
+	c.Registers.A = 3
+	if l.Check(c) != conditional || conditional.Hits != 1 {
+		t.Error("didn't stop with the condition true")
+	}
+	if l.Matches(c) != conditional || conditional.Hits != 1 {
+		t.Error("Matches shouldn't count a hit")
+	}
+	l.Toggle(0)
+	if l.Check(c) != nil {
+		t.Error("stopped while disabled")
+	}
+}
@@ -0,0 +1,270 @@
+package breakpoints
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/thatoddmailbox/computer-emu/cpu"
+	"github.com/thatoddmailbox/computer-emu/symbols"
+)
+
+// expression is a compiled condition, which returns non-zero when it's true
+type expression func(c *cpu.CPU) int
+
+var registers = map[string]expression{
+	"a":  func(c *cpu.CPU) int { return int(c.Registers.A) },
+	"f":  func(c *cpu.CPU) int { return int(c.Registers.Flag) },
+	"b":  func(c *cpu.CPU) int { return int(c.Registers.B) },
+	"c":  func(c *cpu.CPU) int { return int(c.Registers.C) },
+	"d":  func(c *cpu.CPU) int { return int(c.Registers.D) },
+	"e":  func(c *cpu.CPU) int { return int(c.Registers.E) },
+	"h":  func(c *cpu.CPU) int { return int(c.Registers.H) },
+	"l":  func(c *cpu.CPU) int { return int(c.Registers.L) },
+	"i":  func(c *cpu.CPU) int { return int(c.Registers.I) },
+	"r":  func(c *cpu.CPU) int { return int(c.Registers.R) },
+	"af": func(c *cpu.CPU) int { return int(c.Registers.A)<<8 | int(c.Registers.Flag) },
+	"bc": func(c *cpu.CPU) int { return int(c.Registers.B)<<8 | int(c.Registers.C) },
+	"de": func(c *cpu.CPU) int { return int(c.Registers.D)<<8 | int(c.Registers.E) },
+	"hl": func(c *cpu.CPU) int { return int(c.Registers.H)<<8 | int(c.Registers.L) },
+	"sp": func(c *cpu.CPU) int { return int(c.Registers.SP) },
+	"ix": func(c *cpu.CPU) int { return int(c.Registers.IX) },
+	"iy": func(c *cpu.CPU) int { return int(c.Registers.IY) },
+	"pc": func(c *cpu.CPU) int { return int(c.PC) },
+}
+
+// flags are named with an f on the end, since c is already a register
+var flags = map[string]uint8{
+	"sf": cpu.FlagSign,
+	"zf": cpu.FlagZero,
+	"hf": cpu.FlagHalfCarry,
+	"pf": cpu.FlagParityOverflow,
+	"vf": cpu.FlagParityOverflow,
+	"nf": cpu.FlagSubtract,
+	"cf": cpu.FlagCarry,
+}
+
+// binary operators, from the loosest to the tightest
+var precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<=", ">=", "<", ">"},
+	{"|", "^", "&"},
+	{"+", "-"},
+}
+
+var operators = []string{"||", "&&", "==", "!=", "<=", ">=", "<", ">", "|", "^", "&", "+", "-", "!", "[", "]", "(", ")"}
+
+func boolToInt(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func tokenize(text string) ([]string, error) {
+	tokens := []string{}
+	for i := 0; i < len(text); {
+		if text[i] == ' ' || text[i] == '\t' {
+			i += 1
+			continue
+		}
+
+		operatorFound := false
+		for _, operator := range operators {
+			if strings.HasPrefix(text[i:], operator) {
+				tokens = append(tokens, operator)
+				i += len(operator)
+				operatorFound = true
+				break
+			}
+		}
+		if operatorFound {
+			continue
+		}
+
+		start := i
+		for i < len(text) && (text[i] == '_' || text[i] == '.' || text[i] == '$' || (text[i] >= '0' && text[i] <= '9') || (text[i] >= 'a' && text[i] <= 'z') || (text[i] >= 'A' && text[i] <= 'Z')) {
+			i += 1
+		}
+		if i == start {
+			return nil, fmt.Errorf("unexpected '%c'", text[i])
+		}
+		tokens = append(tokens, text[start:i])
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens  []string
+	symbols *symbols.Symbols
+}
+
+func (p *parser) peek() string {
+	if len(p.tokens) == 0 {
+		return ""
+	}
+	return p.tokens[0]
+}
+
+func (p *parser) next() string {
+	token := p.peek()
+	if len(p.tokens) > 0 {
+		p.tokens = p.tokens[1:]
+	}
+	return token
+}
+
+func (p *parser) expect(token string) error {
+	if p.next() != token {
+		return fmt.Errorf("expected '%s'", token)
+	}
+	return nil
+}
+
+func applyOperator(operator string, left expression, right expression) expression {
+	switch operator {
+	case "||":
+		return func(c *cpu.CPU) int { return boolToInt(left(c) != 0 || right(c) != 0) }
+	case "&&":
+		return func(c *cpu.CPU) int { return boolToInt(left(c) != 0 && right(c) != 0) }
+	case "==":
+		return func(c *cpu.CPU) int { return boolToInt(left(c) == right(c)) }
+	case "!=":
+		return func(c *cpu.CPU) int { return boolToInt(left(c) != right(c)) }
+	case "<=":
+		return func(c *cpu.CPU) int { return boolToInt(left(c) <= right(c)) }
+	case ">=":
+		return func(c *cpu.CPU) int { return boolToInt(left(c) >= right(c)) }
+	case "<":
+		return func(c *cpu.CPU) int { return boolToInt(left(c) < right(c)) }
+	case ">":
+		return func(c *cpu.CPU) int { return boolToInt(left(c) > right(c)) }
+	case "|":
+		return func(c *cpu.CPU) int { return left(c) | right(c) }
+	case "^":
+		return func(c *cpu.CPU) int { return left(c) ^ right(c) }
+	case "&":
+		return func(c *cpu.CPU) int { return left(c) & right(c) }
+	case "+":
+		return func(c *cpu.CPU) int { return left(c) + right(c) }
+	case "-":
+		return func(c *cpu.CPU) int { return left(c) - right(c) }
+	}
+	panic("unknown operator")
+}
+
+func (p *parser) parseBinary(level int) (expression, error) {
+	if level == len(precedence) {
+		return p.parseUnary()
+	}
+
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		operator := p.peek()
+		found := false
+		for _, levelOperator := range precedence[level] {
+			if operator == levelOperator {
+				found = true
+			}
+		}
+		if !found {
+			return left, nil
+		}
+		p.next()
+
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = applyOperator(operator, left, right)
+	}
+}
+
+func (p *parser) parseUnary() (expression, error) {
+	token := p.next()
+	switch token {
+	case "":
+		return nil, fmt.Errorf("unexpected end of condition")
+	case "!", "-":
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if token == "!" {
+			return func(c *cpu.CPU) int { return boolToInt(operand(c) == 0) }, nil
+		}
+		return func(c *cpu.CPU) int { return -operand(c) }, nil
+	case "(":
+		inner, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	case "[":
+		// the byte at an address
+		address, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		return func(c *cpu.CPU) int { return int(c.Bus.PeekMemoryByte(uint16(address(c)))) }, p.expect("]")
+	}
+
+	value, ok := parseNumber(token)
+	if ok {
+		return func(c *cpu.CPU) int { return value }, nil
+	}
+
+	name := strings.ToLower(token)
+	if register, ok := registers[name]; ok {
+		return register, nil
+	}
+	if flag, ok := flags[name]; ok {
+		return func(c *cpu.CPU) int { return boolToInt(c.Registers.Flag&flag != 0) }, nil
+	}
+	if address, ok := p.symbols.Resolve(token); ok {
+		return func(c *cpu.CPU) int { return int(address) }, nil
+	}
+	return nil, fmt.Errorf("unknown name '%s'", token)
+}
+
+// parseNumber parses 0x1f, $1f, or 31
+func parseNumber(token string) (int, bool) {
+	var value uint64
+	var err error
+	if strings.HasPrefix(token, "0x") || strings.HasPrefix(token, "0X") {
+		value, err = strconv.ParseUint(token[2:], 16, 32)
+	} else if strings.HasPrefix(token, "$") {
+		value, err = strconv.ParseUint(token[1:], 16, 32)
+	} else if token[0] >= '0' && token[0] <= '9' {
+		value, err = strconv.ParseUint(token, 10, 32)
+	} else {
+		return 0, false
+	}
+	return int(value), err == nil
+}
+
+// compile turns a condition like A==3 && [0xF004]>0x10 into something that can be run quickly before each instruction.
+// Labels are looked up in s, which can be nil.
+func compile(text string, s *symbols.Symbols) (expression, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{
+		tokens:  tokens,
+		symbols: s,
+	}
+	compiled, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.tokens) > 0 {
+		return nil, fmt.Errorf("unexpected '%s'", p.tokens[0])
+	}
+	return compiled, nil
+}
@@ -1,56 +1,347 @@
 package bus
 
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+var ErrUnmapped = errors.New("bus: nothing mapped at address")
+var ErrNotPokeable = errors.New("bus: device can't be written to directly")
+
 type BusMemoryIODevice interface {
 	IsMapped(address uint16) bool
 	ReadByte(address uint16) uint8
-	WriteByte(address uint16, data uint8)
+	WriteByte(address uint16, data uint8) error
+}
+
+// TimedDevice is a BusMemoryIODevice that says how quickly it responds.
+// WaitStates is how many t-states the board's /WAIT circuitry adds to each access, or 0 if there isn't any.
+type TimedDevice interface {
+	AccessTime() time.Duration
+	WaitStates() int
+}
+
+// StatefulDevice is a device with internal state that's kept in save states, like RAM contents or latched registers.
+// LoadState reads back exactly what SaveState wrote.
+type StatefulDevice interface {
+	SaveState(w io.Writer) error
+	LoadState(r io.Reader) error
+}
+
+// PeekableDevice is a BusMemoryIODevice that can be read without changing anything, like plain memory.
+type PeekableDevice interface {
+	PeekByte(address uint16) uint8
+}
+
+// PokeableDevice is a BusMemoryIODevice that something like the debugger can write to, even if the cpu can't, like a rom that could be reprogrammed.
+type PokeableDevice interface {
+	PokeByte(address uint16, data uint8) error
+}
+
+// AccessHook is told about each memory and IO access just before it happens.
+type AccessHook interface {
+	MemoryAccess(device BusMemoryIODevice, address uint16, write bool)
+	IOAccess(device BusDataIODevice, address uint8, write bool)
 }
 
 type BusDataIODevice interface {
 	IsMapped(address uint8) bool
 	ReadByte(address uint8) uint8
-	WriteByte(address uint8, data uint8)
+	WriteByte(address uint8, data uint8) error
 }
 
 type EmulatorBus struct {
 	MemoryDevices []BusMemoryIODevice
 	DataDevices   []BusDataIODevice
+	Interrupts    *InterruptLines
+	Hooks         []AccessHook
+
+	// the first access that failed since TakeFault was last called
+	fault *AccessError
+
+	// wait states for each of MemoryDevices, worked out again whenever a device is added or replaced
+	memoryWaitStates []deviceWaitStates
+	waitStates       uint64
 }
 
-func (b *EmulatorBus) ReadMemoryByte(address uint16) uint8 {
+// the wait states for a memory device, along with the device, so that replacing it is noticed
+type deviceWaitStates struct {
+	device     BusMemoryIODevice
+	waitStates uint64
+}
+
+// AccessError is a memory or IO access that failed, either because nothing was mapped there or because the device refused it.
+type AccessError struct {
+	Address uint16
+	Write   bool
+	IO      bool
+
+	// nil if nothing was mapped
+	Device interface{}
+
+	Err error
+}
+
+func (e *AccessError) Error() string {
+	kind := "memory"
+	if e.IO {
+		kind = "IO"
+	}
+	direction := "read from"
+	if e.Write {
+		direction = "write to"
+	}
+	if e.Device == nil {
+		return fmt.Sprintf("bus: %s unmapped %s at 0x%04X", direction, kind, e.Address)
+	}
+	return fmt.Sprintf("bus: %s %s at 0x%04X failed on %T: %v", direction, kind, e.Address, e.Device, e.Err)
+}
+
+func (e *AccessError) Unwrap() error {
+	return e.Err
+}
+
+type interruptRequest struct {
+	source interface{}
+	data   uint8
+}
+
+// InterruptLines models /INT and /NMI. /INT is level triggered and stays low as long as any device asserts it, /NMI is edge triggered.
+// Devices can change these from any goroutine.
+type InterruptLines struct {
+	mutex      sync.Mutex
+	requests   []interruptRequest
+	nmiPending bool
+}
+
+func NewInterruptLines() *InterruptLines {
+	return &InterruptLines{}
+}
+
+// Assert pulls /INT low on behalf of source. data is what the device puts on the data bus when the interrupt is acknowledged, which is 0xFF if nothing drives it.
+func (l *InterruptLines) Assert(source interface{}, data uint8) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for i, request := range l.requests {
+		if request.source == source {
+			l.requests[i].data = data
+			return
+		}
+	}
+	l.requests = append(l.requests, interruptRequest{source, data})
+}
+
+func (l *InterruptLines) Deassert(source interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for i, request := range l.requests {
+		if request.source == source {
+			l.requests = append(l.requests[:i], l.requests[i+1:]...)
+			return
+		}
+	}
+}
+
+func (l *InterruptLines) TriggerNMI() {
+	l.mutex.Lock()
+	l.nmiPending = true
+	l.mutex.Unlock()
+}
+
+func (b *EmulatorBus) InterruptRequested() bool {
+	if b.Interrupts == nil {
+		return false
+	}
+	b.Interrupts.mutex.Lock()
+	defer b.Interrupts.mutex.Unlock()
+	return len(b.Interrupts.requests) > 0
+}
+
+// AcknowledgeInterrupt returns the byte on the data bus during the interrupt acknowledge cycle.
+// The device that asserted /INT first wins, like the first device in a daisy chain.
+func (b *EmulatorBus) AcknowledgeInterrupt() uint8 {
+	if b.Interrupts == nil {
+		return 0xFF
+	}
+	b.Interrupts.mutex.Lock()
+	defer b.Interrupts.mutex.Unlock()
+	if len(b.Interrupts.requests) == 0 {
+		return 0xFF
+	}
+	return b.Interrupts.requests[0].data
+}
+
+// TakeNMI returns whether /NMI has had a falling edge since it was last called
+func (b *EmulatorBus) TakeNMI() bool {
+	if b.Interrupts == nil {
+		return false
+	}
+	b.Interrupts.mutex.Lock()
+	defer b.Interrupts.mutex.Unlock()
+	pending := b.Interrupts.nmiPending
+	b.Interrupts.nmiPending = false
+	return pending
+}
+
+func (b *EmulatorBus) recordFault(fault *AccessError) {
+	if b.fault == nil {
+		b.fault = fault
+	}
+}
+
+// TakeFault returns the first access that failed since it was last called, or nil if they all worked.
+// Failed reads return 0xFF, like an undriven data bus, so the CPU can finish the instruction before it checks this.
+func (b *EmulatorBus) TakeFault() error {
+	if b.fault == nil {
+		return nil
+	}
+	fault := b.fault
+	b.fault = nil
+	return fault
+}
+
+// TakeWaitStates returns the number of wait states from accesses since it was last called
+func (b *EmulatorBus) TakeWaitStates() uint64 {
+	waitStates := b.waitStates
+	b.waitStates = 0
+	return waitStates
+}
+
+func (b *EmulatorBus) addWaitStates(deviceIndex int) {
+	if len(b.memoryWaitStates) != len(b.MemoryDevices) {
+		b.memoryWaitStates = make([]deviceWaitStates, len(b.MemoryDevices))
+	}
+
+	device := b.MemoryDevices[deviceIndex]
+	cached := &b.memoryWaitStates[deviceIndex]
+	if cached.device != device {
+		cached.device = device
+		cached.waitStates = 0
+		timedDevice, ok := device.(TimedDevice)
+		if ok {
+			cached.waitStates = uint64(timedDevice.WaitStates())
+		}
+	}
+	b.waitStates += cached.waitStates
+}
+
+// CheckAccessTimes returns a warning for each memory device that's too slow to keep up with the given clock speed.
+func (b *EmulatorBus) CheckAccessTimes(clockSpeed int) []string {
+	warnings := []string{}
+	tState := time.Second / time.Duration(clockSpeed)
+
+	// opcode fetches have the least time: the chip is selected when /MREQ falls halfway through T1,
+	// and the data has to be ready a little before T3, after the cpu's own delays
+	available := tState*3/2 - 120*time.Nanosecond
+
 	for _, device := range b.MemoryDevices {
+		timedDevice, ok := device.(TimedDevice)
+		if !ok {
+			continue
+		}
+
+		allowed := available + time.Duration(timedDevice.WaitStates())*tState
+		if timedDevice.AccessTime() > allowed {
+			warnings = append(warnings, fmt.Sprintf("%T needs %s to respond, but only gets %s at %d Hz with %d wait states", device, timedDevice.AccessTime(), allowed, clockSpeed, timedDevice.WaitStates()))
+		}
+	}
+
+	return warnings
+}
+
+func (b *EmulatorBus) ReadMemoryByte(address uint16) uint8 {
+	for i, device := range b.MemoryDevices {
 		if device.IsMapped(address) {
+			b.addWaitStates(i)
+			for _, hook := range b.Hooks {
+				hook.MemoryAccess(device, address, false)
+			}
 			return device.ReadByte(address)
 		}
 	}
-	panic("bus: read from unmapped memory")
+	b.recordFault(&AccessError{Address: address, Err: ErrUnmapped})
+	return 0xFF
 }
 
-func (b *EmulatorBus) WriteMemoryByte(address uint16, data uint8) {
+// PeekMemoryByte reads memory for something looking at it, like the debugger, without hooks, wait states, or faults.
+// Devices that can't be read without changing something, like the UART, read as 0xFF.
+func (b *EmulatorBus) PeekMemoryByte(address uint16) uint8 {
 	for _, device := range b.MemoryDevices {
 		if device.IsMapped(address) {
-			device.WriteByte(address, data)
+			peekableDevice, ok := device.(PeekableDevice)
+			if !ok {
+				return 0xFF
+			}
+			return peekableDevice.PeekByte(address)
+		}
+	}
+	return 0xFF
+}
+
+// PokeMemoryByte writes memory for something patching it, like the debugger, without hooks, wait states, or faults.
+// Unlike WriteMemoryByte, it can write to roms that could be reprogrammed, but devices that can't be written to directly return an *AccessError.
+func (b *EmulatorBus) PokeMemoryByte(address uint16, data uint8) error {
+	for _, device := range b.MemoryDevices {
+		if device.IsMapped(address) {
+			pokeableDevice, ok := device.(PokeableDevice)
+			if !ok {
+				return &AccessError{Address: address, Write: true, Device: device, Err: ErrNotPokeable}
+			}
+			err := pokeableDevice.PokeByte(address, data)
+			if err != nil {
+				return &AccessError{Address: address, Write: true, Device: device, Err: err}
+			}
+			return nil
+		}
+	}
+	return &AccessError{Address: address, Write: true, Err: ErrUnmapped}
+}
+
+func (b *EmulatorBus) WriteMemoryByte(address uint16, data uint8) {
+	for i, device := range b.MemoryDevices {
+		if device.IsMapped(address) {
+			b.addWaitStates(i)
+			for _, hook := range b.Hooks {
+				hook.MemoryAccess(device, address, true)
+			}
+			err := device.WriteByte(address, data)
+			if err != nil {
+				b.recordFault(&AccessError{Address: address, Write: true, Device: device, Err: err})
+			}
 			return
 		}
 	}
-	panic("bus: write to unmapped memory")
+	b.recordFault(&AccessError{Address: address, Write: true, Err: ErrUnmapped})
 }
 
 func (b *EmulatorBus) ReadIOByte(address uint8) uint8 {
 	for _, device := range b.DataDevices {
 		if device.IsMapped(address) {
+			for _, hook := range b.Hooks {
+				hook.IOAccess(device, address, false)
+			}
 			return device.ReadByte(address)
 		}
 	}
-	panic("bus: read from unmapped IO")
+	b.recordFault(&AccessError{Address: uint16(address), IO: true, Err: ErrUnmapped})
+	return 0xFF
 }
 
 func (b *EmulatorBus) WriteIOByte(address uint8, data uint8) {
 	for _, device := range b.DataDevices {
 		if device.IsMapped(address) {
-			device.WriteByte(address, data)
+			for _, hook := range b.Hooks {
+				hook.IOAccess(device, address, true)
+			}
+			err := device.WriteByte(address, data)
+			if err != nil {
+				b.recordFault(&AccessError{Address: uint16(address), Write: true, IO: true, Device: device, Err: err})
+			}
 			return
 		}
 	}
-	panic("bus: write to unmapped IO")
+	b.recordFault(&AccessError{Address: uint16(address), Write: true, IO: true, Err: ErrUnmapped})
 }
@@ -0,0 +1,32 @@
+package bus
+
+import (
+	"testing"
+	"time"
+)
+
+type slowMemory struct {
+	wait int
+}
+
+func (m *slowMemory) IsMapped(address uint16) bool               { return true }
+func (m *slowMemory) ReadByte(address uint16) uint8              { return 0x00 }
+func (m *slowMemory) WriteByte(address uint16, data uint8) error { return nil }
+func (m *slowMemory) AccessTime() time.Duration                  { return 0 }
+func (m *slowMemory) WaitStates() int                            { return m.wait }
+
+func TestWaitStatesAfterReplacingDevice(t *testing.T) {
+	b := EmulatorBus{}
+	b.MemoryDevices = append(b.MemoryDevices, &slowMemory{wait: 1})
+	b.ReadMemoryByte(0x0000)
+	if waitStates := b.TakeWaitStates(); waitStates != 1 {
+		t.Errorf("got %d wait states, expected 1", waitStates)
+	}
+
+	// like loading a state with a different mapping
+	b.MemoryDevices[0] = &slowMemory{wait: 3}
+	b.ReadMemoryByte(0x0000)
+	if waitStates := b.TakeWaitStates(); waitStates != 3 {
+		t.Errorf("got %d wait states after replacing the device, expected 3", waitStates)
+	}
+}
@@ -0,0 +1,104 @@
+// Package coverage keeps track of which ROM bytes ran as instructions, which were read as data, and which were never touched.
+package coverage
+
+import (
+	"github.com/thatoddmailbox/computer-emu/bus"
+	"github.com/thatoddmailbox/computer-emu/cpu"
+)
+
+const (
+	// the first byte of an instruction that ran
+	flagOpcode uint8 = 1 << iota
+
+	// any other byte of an instruction that ran, including its operands
+	flagOperand
+
+	// read by an instruction as data
+	flagData
+)
+
+type romCoverage struct {
+	device bus.BusMemoryIODevice
+
+	// by cpu address, since that's what listings use
+	flags      [0x10000]uint8
+	executions [0x10000]uint32
+}
+
+type pendingRead struct {
+	rom     *romCoverage
+	address uint16
+}
+
+// Coverage is an AccessHook and ExecutionObserver. It works out which reads were the instruction being fetched once the cpu says where the instruction was.
+type Coverage struct {
+	cpu  *cpu.CPU
+	roms []*romCoverage
+
+	// reads from the roms since Begin
+	pending []pendingRead
+
+	// the reports read memory too, which shouldn't count
+	reporting bool
+}
+
+// NewCoverage creates a Coverage for the given roms, and hooks it into the cpu and its bus.
+func NewCoverage(c *cpu.CPU, roms ...bus.BusMemoryIODevice) *Coverage {
+	cv := &Coverage{
+		cpu: c,
+	}
+	for _, rom := range roms {
+		cv.roms = append(cv.roms, &romCoverage{device: rom})
+	}
+	c.Bus.Hooks = append(c.Bus.Hooks, cv)
+	c.Observers = append(c.Observers, cv)
+	return cv
+}
+
+func (cv *Coverage) romFor(device interface{}) *romCoverage {
+	for _, rom := range cv.roms {
+		if rom.device == device {
+			return rom
+		}
+	}
+	return nil
+}
+
+// Begin forgets about anything that's been read since the last instruction, like the debugger's disassembly, and should be called right before the cpu steps.
+func (cv *Coverage) Begin() {
+	cv.pending = cv.pending[:0]
+}
+
+func (cv *Coverage) MemoryAccess(device bus.BusMemoryIODevice, address uint16, write bool) {
+	if write || cv.reporting {
+		return
+	}
+	rom := cv.romFor(device)
+	if rom != nil {
+		cv.pending = append(cv.pending, pendingRead{rom, address})
+	}
+}
+
+func (cv *Coverage) IOAccess(device bus.BusDataIODevice, address uint8, write bool) {
+}
+
+func (cv *Coverage) Executed(pc uint16, length uint16, cycles uint64) {
+	for _, read := range cv.pending {
+		offset := read.address - pc
+		if offset == 0 && length > 0 {
+			read.rom.flags[read.address] |= flagOpcode
+			read.rom.executions[read.address] += 1
+		} else if offset < length {
+			read.rom.flags[read.address] |= flagOperand
+		} else {
+			read.rom.flags[read.address] |= flagData
+		}
+	}
+	cv.pending = cv.pending[:0]
+}
+
+func (cv *Coverage) Called(target uint16) {
+}
+
+func (cv *Coverage) Returned() {
+}
@@ -0,0 +1,298 @@
+package coverage
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/thatoddmailbox/computer-emu/bus"
+	"github.com/thatoddmailbox/computer-emu/cpu"
+	"github.com/thatoddmailbox/computer-emu/symbols"
+)
+
+// untouched runs of the same byte longer than this are collapsed into one line
+const collapseLength = 16
+
+// data bytes are listed this many to a line
+const dataBytesPerLine = 8
+
+func (rom *romCoverage) peek(c *cpu.CPU, address uint16) uint8 {
+	peekableDevice, ok := rom.device.(bus.PeekableDevice)
+	if ok {
+		return peekableDevice.PeekByte(address)
+	}
+	return c.Bus.ReadMemoryByte(address)
+}
+
+func formatBytes(rom *romCoverage, c *cpu.CPU, address uint16, length int) string {
+	parts := []string{}
+	for i := 0; i < length; i++ {
+		parts = append(parts, fmt.Sprintf("%02X", rom.peek(c, address+uint16(i))))
+	}
+	return strings.Join(parts, " ")
+}
+
+// whether each of the length bytes from address has exactly the given flags, which is false if any of them are outside of the rom
+func (rom *romCoverage) allFlagsEqual(address uint16, length int, flags uint8) bool {
+	for i := 0; i < length; i++ {
+		current := address + uint16(i)
+		if int(address)+i > 0xFFFF || !rom.device.IsMapped(current) || rom.flags[current] != flags {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteListing writes a disassembly of every rom, with each line marked by how it was used:
+// X for instructions that ran, with how many times they ran, x for bytes that were only seen as part of an instruction
+// (usually when something jumped into the middle of one), D for data, and . for bytes that were never touched.
+// Untouched bytes are disassembled too if they can be, since they're usually code that never ran.
+func (cv *Coverage) WriteListing(w io.Writer) error {
+	cv.reporting = true
+	defer func() {
+		cv.reporting = false
+	}()
+
+	_, err := fmt.Fprintln(w, "; X: ran, x: part of an instruction, D: read as data, .: never touched")
+	if err != nil {
+		return err
+	}
+
+	for _, rom := range cv.roms {
+		err = cv.writeROMListing(w, rom)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cv *Coverage) writeROMListing(w io.Writer, rom *romCoverage) error {
+	instructions, code, data, untouched := 0, 0, 0, 0
+	for address := 0; address <= 0xFFFF; address++ {
+		if !rom.device.IsMapped(uint16(address)) {
+			continue
+		}
+		flags := rom.flags[address]
+		if flags&flagOpcode != 0 {
+			instructions += 1
+		}
+		if flags&(flagOpcode|flagOperand) != 0 {
+			code += 1
+		} else if flags&flagData != 0 {
+			data += 1
+		} else {
+			untouched += 1
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "\n; %T: %d instructions ran, %d bytes of code, %d bytes of data, %d bytes never touched\n", rom.device, instructions, code, data, untouched)
+	if err != nil {
+		return err
+	}
+
+	address := 0
+	for address <= 0xFFFF {
+		current := uint16(address)
+		if !rom.device.IsMapped(current) {
+			address += 1
+			continue
+		}
+
+		label := cv.cpu.Symbols.Label(current)
+		if label != "" {
+			_, err = fmt.Fprintf(w, "%s:\n", label)
+			if err != nil {
+				return err
+			}
+		}
+
+		flags := rom.flags[current]
+		length := 1
+		if flags&flagOpcode != 0 {
+			instruction := cpu.DisassembleAt(cv.cpu, current)
+			length = int(instruction.Length())
+			_, err = fmt.Fprintf(w, "X %04X  %-11s  %-24s ; %d\n", current, formatBytes(rom, cv.cpu, current, length), instruction.Format(cv.cpu.Symbols), rom.executions[current])
+		} else if flags&flagOperand != 0 {
+			_, err = fmt.Fprintf(w, "x %04X  %-11s  db 0x%02X\n", current, formatBytes(rom, cv.cpu, current, 1), rom.peek(cv.cpu, current))
+		} else if flags&flagData != 0 {
+			for length < dataBytesPerLine && rom.allFlagsEqual(current+uint16(length), 1, flagData) && address+length <= 0xFFFF {
+				length += 1
+			}
+			values := []string{}
+			for i := 0; i < length; i++ {
+				values = append(values, fmt.Sprintf("0x%02X", rom.peek(cv.cpu, current+uint16(i))))
+			}
+			_, err = fmt.Fprintf(w, "D %04X  %-23s  db %s\n", current, formatBytes(rom, cv.cpu, current, length), strings.Join(values, ", "))
+		} else {
+			// never touched, so it's either code that never ran or unused space
+			value := rom.peek(cv.cpu, current)
+			run := 1
+			for address+run <= 0xFFFF && rom.allFlagsEqual(current+uint16(run), 1, 0) && rom.peek(cv.cpu, current+uint16(run)) == value {
+				run += 1
+			}
+
+			if run > collapseLength {
+				length = run
+				_, err = fmt.Fprintf(w, ". %04X  ... %d bytes of 0x%02X\n", current, run, value)
+			} else {
+				instruction := cpu.DisassembleAt(cv.cpu, current)
+				if instruction.Known() && rom.allFlagsEqual(current, int(instruction.Length()), 0) {
+					length = int(instruction.Length())
+					_, err = fmt.Fprintf(w, ". %04X  %-11s  %s\n", current, formatBytes(rom, cv.cpu, current, length), instruction.Format(cv.cpu.Symbols))
+				} else {
+					_, err = fmt.Fprintf(w, ". %04X  %-11s  db 0x%02X\n", current, formatBytes(rom, cv.cpu, current, 1), value)
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		if length < 1 {
+			length = 1
+		}
+		address += length
+	}
+
+	return nil
+}
+
+type lineCoverage struct {
+	number int
+	hits   uint32
+}
+
+// the instruction lines of a listing that are in one of the roms, with how many times each ran
+func (cv *Coverage) listingCoverage(listing *symbols.Listing) []lineCoverage {
+	lines := []lineCoverage{}
+	for _, line := range listing.Lines {
+		if line.IsData() {
+			continue
+		}
+		for _, rom := range cv.roms {
+			if rom.device.IsMapped(line.Address) {
+				lines = append(lines, lineCoverage{line.Number, rom.executions[line.Address]})
+				break
+			}
+		}
+	}
+	return lines
+}
+
+// WriteLCOV writes the coverage of each listing's lines in the lcov tracefile format, with the listings standing in for source files.
+func (cv *Coverage) WriteLCOV(w io.Writer, listings []*symbols.Listing) error {
+	for _, listing := range listings {
+		lines := cv.listingCoverage(listing)
+
+		_, err := fmt.Fprintf(w, "TN:\nSF:%s\n", listing.Path)
+		if err != nil {
+			return err
+		}
+		hit := 0
+		for _, line := range lines {
+			if line.hits > 0 {
+				hit += 1
+			}
+			_, err = fmt.Fprintf(w, "DA:%d,%d\n", line.number, line.hits)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = fmt.Fprintf(w, "LF:%d\nLH:%d\nend_of_record\n", len(lines), hit)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type coberturaLine struct {
+	Number int    `xml:"number,attr"`
+	Hits   uint32 `xml:"hits,attr"`
+}
+
+type coberturaClass struct {
+	Name       string          `xml:"name,attr"`
+	Filename   string          `xml:"filename,attr"`
+	LineRate   float64         `xml:"line-rate,attr"`
+	BranchRate float64         `xml:"branch-rate,attr"`
+	Methods    struct{}        `xml:"methods"`
+	Lines      []coberturaLine `xml:"lines>line"`
+}
+
+type coberturaPackage struct {
+	Name       string           `xml:"name,attr"`
+	LineRate   float64          `xml:"line-rate,attr"`
+	BranchRate float64          `xml:"branch-rate,attr"`
+	Classes    []coberturaClass `xml:"classes>class"`
+}
+
+type coberturaCoverage struct {
+	XMLName      xml.Name           `xml:"coverage"`
+	LineRate     float64            `xml:"line-rate,attr"`
+	BranchRate   float64            `xml:"branch-rate,attr"`
+	LinesCovered int                `xml:"lines-covered,attr"`
+	LinesValid   int                `xml:"lines-valid,attr"`
+	Version      string             `xml:"version,attr"`
+	Timestamp    int64              `xml:"timestamp,attr"`
+	Sources      []string           `xml:"sources>source"`
+	Packages     []coberturaPackage `xml:"packages>package"`
+}
+
+func lineRate(covered int, valid int) float64 {
+	if valid == 0 {
+		return 0
+	}
+	return float64(covered) / float64(valid)
+}
+
+// WriteCobertura writes the coverage of each listing's lines as Cobertura XML, with a class for each listing.
+func (cv *Coverage) WriteCobertura(w io.Writer, listings []*symbols.Listing) error {
+	report := coberturaCoverage{
+		Version:   "computer-emu",
+		Timestamp: time.Now().Unix(),
+		Sources:   []string{"."},
+	}
+	firmware := coberturaPackage{
+		Name: "firmware",
+	}
+
+	for _, listing := range listings {
+		class := coberturaClass{
+			Name:     listing.Path,
+			Filename: listing.Path,
+		}
+		covered := 0
+		for _, line := range cv.listingCoverage(listing) {
+			if line.hits > 0 {
+				covered += 1
+			}
+			class.Lines = append(class.Lines, coberturaLine{line.number, line.hits})
+		}
+		class.LineRate = lineRate(covered, len(class.Lines))
+		firmware.Classes = append(firmware.Classes, class)
+
+		report.LinesCovered += covered
+		report.LinesValid += len(class.Lines)
+	}
+
+	report.LineRate = lineRate(report.LinesCovered, report.LinesValid)
+	firmware.LineRate = report.LineRate
+	report.Packages = []coberturaPackage{firmware}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "\t")
+	err = encoder.Encode(&report)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
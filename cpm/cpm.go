@@ -0,0 +1,130 @@
+// Package cpm runs CP/M .COM programs without the rest of the computer, which is enough for instruction exercisers like ZEXDOC and ZEXALL.
+package cpm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/thatoddmailbox/computer-emu/cpu"
+)
+
+const (
+	LoadAddress = 0x0100
+
+	warmBootAddress = 0x0000
+	bdosAddress     = 0x0005
+
+	// where the bdos entry point jumps to. programs read this to find the top of memory.
+	bdosTopAddress = 0xFE00
+)
+
+var ErrProgramTooLarge = errors.New("cpm: program doesn't fit in memory")
+var ErrHalted = errors.New("cpm: program halted")
+var ErrCycleLimit = errors.New("cpm: program ran for too long")
+
+// cp/m expects ram everywhere
+type memory struct {
+	RAM [64 * 1024]byte
+}
+
+func (m *memory) IsMapped(address uint16) bool {
+	return true
+}
+
+func (m *memory) ReadByte(address uint16) uint8 {
+	return m.RAM[address]
+}
+
+func (m *memory) WriteByte(address uint16, data uint8) error {
+	m.RAM[address] = data
+	return nil
+}
+
+type Machine struct {
+	CPU    cpu.CPU
+	Output io.Writer
+
+	// Run gives up after this many t-states, or never if it's 0
+	MaxCycles uint64
+
+	memory *memory
+}
+
+func NewMachine(program []byte, output io.Writer) (*Machine, error) {
+	if len(program) > bdosTopAddress-LoadAddress {
+		return nil, ErrProgramTooLarge
+	}
+
+	m := &Machine{
+		Output: output,
+		memory: &memory{},
+	}
+	m.CPU.Bus.MemoryDevices = append(m.CPU.Bus.MemoryDevices, m.memory)
+
+	// jp to the bdos, which just returns since the calls are trapped before they get there
+	m.memory.RAM[bdosAddress] = 0xC3
+	m.memory.RAM[bdosAddress+1] = uint8(bdosTopAddress & 0xFF)
+	m.memory.RAM[bdosAddress+2] = uint8(bdosTopAddress >> 8)
+	m.memory.RAM[bdosTopAddress] = 0xC9
+
+	copy(m.memory.RAM[LoadAddress:], program)
+
+	// returning from the program warm boots, like with the ccp
+	m.CPU.PC = LoadAddress
+	m.CPU.Registers.SP = bdosTopAddress
+	m.CPU.Push(uint8(warmBootAddress >> 8))
+	m.CPU.Push(uint8(warmBootAddress & 0xFF))
+
+	return m, nil
+}
+
+// Run executes the program until it warm boots by jumping to 0x0000.
+func (m *Machine) Run() error {
+	for {
+		if m.CPU.PC == bdosAddress {
+			err := m.bdosCall()
+			if err != nil {
+				return err
+			}
+		}
+
+		err := m.CPU.Step(func() {})
+		if err != nil {
+			return err
+		}
+
+		if m.CPU.PC == warmBootAddress {
+			return nil
+		}
+		if m.CPU.Halted {
+			// there's nothing to interrupt it
+			return ErrHalted
+		}
+		if m.MaxCycles != 0 && m.CPU.Cycles > m.MaxCycles {
+			return ErrCycleLimit
+		}
+	}
+}
+
+func (m *Machine) bdosCall() error {
+	function := m.CPU.Registers.C
+	switch function {
+	case 2:
+		// console output, with the character in e
+		_, err := m.Output.Write([]byte{m.CPU.Registers.E})
+		return err
+	case 9:
+		// print string, from de up to a $
+		address := uint16(m.CPU.Registers.D)<<8 | uint16(m.CPU.Registers.E)
+		output := []byte{}
+		for len(output) < len(m.memory.RAM) && m.memory.RAM[address] != '$' {
+			output = append(output, m.memory.RAM[address])
+			address += 1
+		}
+		_, err := m.Output.Write(output)
+		return err
+	default:
+		return fmt.Errorf("cpm: unsupported bdos function %d", function)
+	}
+}
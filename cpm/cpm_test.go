@@ -0,0 +1,80 @@
+package cpm
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// zexdoc takes a few hours on a real z80, and about 46 billion t-states
+const exerciserCycleLimit = 100000000000
+
+func TestBDOSOutput(t *testing.T) {
+	// ld c, 9; ld de, message; call 5; ld c, 2; ld e, '!'; call 5; ret; message: "hi$"
+	program := []byte{0x0E, 0x09, 0x11, 0x10, 0x01, 0xCD, 0x05, 0x00, 0x0E, 0x02, 0x1E, '!', 0xCD, 0x05, 0x00, 0xC9, 'h', 'i', '$'}
+
+	output := &bytes.Buffer{}
+	machine, err := NewMachine(program, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = machine.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != "hi!" {
+		t.Errorf("output was %q, expected %q", output.String(), "hi!")
+	}
+}
+
+func TestHalted(t *testing.T) {
+	machine, err := NewMachine([]byte{0x76}, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = machine.Run()
+	if !errors.Is(err, ErrHalted) {
+		t.Errorf("expected ErrHalted, got %v", err)
+	}
+}
+
+func runExerciser(t *testing.T, name string) {
+	program, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if os.IsNotExist(err) {
+		t.Skipf("testdata/%s isn't there", name)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if testing.Short() {
+		t.Skip("skipping the exerciser in short mode")
+	}
+
+	output := &bytes.Buffer{}
+	machine, err := NewMachine(program, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine.MaxCycles = exerciserCycleLimit
+
+	err = machine.Run()
+	t.Logf("%s output:\n%s", name, output.String())
+	if err != nil {
+		t.Fatalf("%s didn't finish: %v (PC: 0x%04X)", name, err, machine.CPU.PC)
+	}
+	if strings.Contains(output.String(), "ERROR") {
+		t.Errorf("%s found errors", name)
+	}
+}
+
+func TestZEXDOC(t *testing.T) {
+	runExerciser(t, "zexdoc.com")
+}
+
+func TestZEXALL(t *testing.T) {
+	runExerciser(t, "zexall.com")
+}
@@ -1,61 +1,141 @@
 package cpu
 
-func (c *CPU) setAlu8OpFlags(result uint8, noOverflowResult int16, subtract bool) {
+// bits 3 and 5 of the flag register aren't documented, but they're usually copies of bits 3 and 5 of some result
+func (c *CPU) setXYFlags(value uint8) {
+	c.setFlag(FlagX, ((value & FlagX) != 0))
+	c.setFlag(FlagY, ((value & FlagY) != 0))
+}
+
+func (c *CPU) setSZPFlags(result uint8) {
 	c.setFlag(FlagSign, ((result & (1 << 7)) != 0))
 	c.setFlag(FlagZero, (result == 0))
-	c.setFlag(FlagParityOverflow, (int16(result) != noOverflowResult))
-	c.setFlag(FlagSubtract, subtract)
-	c.setFlag(FlagCarry, (noOverflowResult > 0xFF || noOverflowResult < 0))
+	c.setFlag(FlagParityOverflow, calcParity(result))
 }
 
-func (c *CPU) setAlu16OpFlags(result uint16, noOverflowResult int32, subtract bool) {
-	c.setFlag(FlagSign, ((result & (1 << 15)) != 0))
+func (c *CPU) carryValue() uint8 {
+	if c.getFlag(FlagCarry) {
+		return 1
+	}
+	return 0
+}
+
+func (c *CPU) add8(a uint8, b uint8, carry uint8) uint8 {
+	noOverflowResult := uint16(a) + uint16(b) + uint16(carry)
+	result := uint8(noOverflowResult)
+	c.setFlag(FlagSign, ((result & (1 << 7)) != 0))
 	c.setFlag(FlagZero, (result == 0))
-	c.setFlag(FlagParityOverflow, (int32(result) != noOverflowResult))
-	c.setFlag(FlagSubtract, subtract)
-	c.setFlag(FlagCarry, (noOverflowResult > 0xFFFF || noOverflowResult < 0))
+	c.setFlag(FlagHalfCarry, ((a^b^result)&0x10 != 0))
+	c.setFlag(FlagParityOverflow, ((a^result)&(b^result)&0x80 != 0))
+	c.setFlag(FlagSubtract, false)
+	c.setFlag(FlagCarry, (noOverflowResult > 0xFF))
+	c.setXYFlags(result)
+	return result
 }
 
-func (c *CPU) Add8WithFlags(a uint8, b uint8) uint8 {
-	result := a + b
-	noOverflowResult := int16(a) + int16(b)
-	c.setAlu8OpFlags(result, noOverflowResult, false)
+func (c *CPU) subtract8(a uint8, b uint8, carry uint8) uint8 {
+	noOverflowResult := int16(a) - int16(b) - int16(carry)
+	result := uint8(noOverflowResult)
+	c.setFlag(FlagSign, ((result & (1 << 7)) != 0))
+	c.setFlag(FlagZero, (result == 0))
+	c.setFlag(FlagHalfCarry, ((a^b^result)&0x10 != 0))
+	c.setFlag(FlagParityOverflow, ((a^b)&(a^result)&0x80 != 0))
+	c.setFlag(FlagSubtract, true)
+	c.setFlag(FlagCarry, (noOverflowResult < 0))
+	c.setXYFlags(result)
 	return result
 }
 
+func (c *CPU) Add8WithFlags(a uint8, b uint8) uint8 {
+	return c.add8(a, b, 0)
+}
+
 func (c *CPU) Subtract8WithFlags(a uint8, b uint8) uint8 {
-	result := a - b
-	noOverflowResult := int16(a) - int16(b)
-	c.setAlu8OpFlags(result, noOverflowResult, true)
+	return c.subtract8(a, b, 0)
+}
+
+// inc and dec leave the carry flag alone
+func (c *CPU) Increment8WithFlags(a uint8) uint8 {
+	result := a + 1
+	c.setFlag(FlagSign, ((result & (1 << 7)) != 0))
+	c.setFlag(FlagZero, (result == 0))
+	c.setFlag(FlagHalfCarry, (result&0x0F == 0))
+	c.setFlag(FlagParityOverflow, (result == 0x80))
+	c.setFlag(FlagSubtract, false)
+	c.setXYFlags(result)
 	return result
 }
 
-func (c *CPU) Subtract16WithFlags(a uint16, b uint16) uint16 {
-	result := a - b
-	noOverflowResult := int32(a) - int32(b)
-	c.setAlu16OpFlags(result, noOverflowResult, true)
+func (c *CPU) Decrement8WithFlags(a uint8) uint8 {
+	result := a - 1
+	c.setFlag(FlagSign, ((result & (1 << 7)) != 0))
+	c.setFlag(FlagZero, (result == 0))
+	c.setFlag(FlagHalfCarry, (result&0x0F == 0x0F))
+	c.setFlag(FlagParityOverflow, (result == 0x7F))
+	c.setFlag(FlagSubtract, true)
+	c.setXYFlags(result)
+	return result
+}
+
+// add hl, rp only affects the half carry, subtract, carry, and undocumented flags
+func (c *CPU) Add16WithFlags(a uint16, b uint16) uint16 {
+	noOverflowResult := uint32(a) + uint32(b)
+	result := uint16(noOverflowResult)
+	c.setFlag(FlagHalfCarry, ((a^b^result)&0x1000 != 0))
+	c.setFlag(FlagSubtract, false)
+	c.setFlag(FlagCarry, (noOverflowResult > 0xFFFF))
+	c.setXYFlags(uint8(result >> 8))
+	return result
+}
+
+func (c *CPU) add16(a uint16, b uint16, carry uint16) uint16 {
+	noOverflowResult := uint32(a) + uint32(b) + uint32(carry)
+	result := uint16(noOverflowResult)
+	c.setFlag(FlagSign, ((result & (1 << 15)) != 0))
+	c.setFlag(FlagZero, (result == 0))
+	c.setFlag(FlagHalfCarry, ((a^b^result)&0x1000 != 0))
+	c.setFlag(FlagParityOverflow, ((a^result)&(b^result)&0x8000 != 0))
+	c.setFlag(FlagSubtract, false)
+	c.setFlag(FlagCarry, (noOverflowResult > 0xFFFF))
+	c.setXYFlags(uint8(result >> 8))
+	return result
+}
+
+func (c *CPU) subtract16(a uint16, b uint16, carry uint16) uint16 {
+	noOverflowResult := int32(a) - int32(b) - int32(carry)
+	result := uint16(noOverflowResult)
+	c.setFlag(FlagSign, ((result & (1 << 15)) != 0))
+	c.setFlag(FlagZero, (result == 0))
+	c.setFlag(FlagHalfCarry, ((a^b^result)&0x1000 != 0))
+	c.setFlag(FlagParityOverflow, ((a^b)&(a^result)&0x8000 != 0))
+	c.setFlag(FlagSubtract, true)
+	c.setFlag(FlagCarry, (noOverflowResult < 0))
+	c.setXYFlags(uint8(result >> 8))
 	return result
 }
 
+func (c *CPU) Subtract16WithFlags(a uint16, b uint16) uint16 {
+	return c.subtract16(a, b, 0)
+}
+
+func (c *CPU) AddWithCarry16WithFlags(a uint16, b uint16) uint16 {
+	return c.add16(a, b, uint16(c.carryValue()))
+}
+
+func (c *CPU) SubtractWithCarry16WithFlags(a uint16, b uint16) uint16 {
+	return c.subtract16(a, b, uint16(c.carryValue()))
+}
+
 func (c *CPU) DoALUOperation(op ALUOperationType, operand uint8) {
 	var result uint8
 	switch op {
 	case ALUOperationAdd:
-		c.Registers.A = c.Add8WithFlags(c.Registers.A, operand)
+		c.Registers.A = c.add8(c.Registers.A, operand, 0)
 	case ALUOperationAdc:
-		carry := uint8(0)
-		if c.getFlag(FlagCarry) {
-			carry = 1
-		}
-		c.Registers.A = c.Add8WithFlags(c.Registers.A, operand+carry)
+		c.Registers.A = c.add8(c.Registers.A, operand, c.carryValue())
 	case ALUOperationSub:
-		c.Registers.A = c.Subtract8WithFlags(c.Registers.A, operand)
+		c.Registers.A = c.subtract8(c.Registers.A, operand, 0)
 	case ALUOperationSbc:
-		carry := uint8(0)
-		if c.getFlag(FlagCarry) {
-			carry = 1
-		}
-		c.Registers.A = c.Subtract8WithFlags(c.Registers.A, operand+carry)
+		c.Registers.A = c.subtract8(c.Registers.A, operand, c.carryValue())
 	case ALUOperationAnd:
 		result = c.Registers.A & operand
 	case ALUOperationXor:
@@ -63,18 +143,19 @@ func (c *CPU) DoALUOperation(op ALUOperationType, operand uint8) {
 	case ALUOperationOr:
 		result = c.Registers.A | operand
 	case ALUOperationCp:
-		c.Subtract8WithFlags(c.Registers.A, operand)
+		c.subtract8(c.Registers.A, operand, 0)
+		// cp takes the undocumented flags from the operand, not the result
+		c.setXYFlags(operand)
 	default:
 		panic("cpu: unknown operation type passed to DoALUOperation")
 	}
 
 	if op == ALUOperationAnd || op == ALUOperationXor || op == ALUOperationOr {
 		c.setFlag(FlagCarry, false)
-		c.setFlag(FlagZero, (result == 0))
-		c.setFlag(FlagParityOverflow, calcParity(result))
-		c.setFlag(FlagSign, (result&(1<<7) != 0))
+		c.setSZPFlags(result)
 		c.setFlag(FlagSubtract, false)
-		c.setFlag(FlagHalfCarry, false)
+		c.setFlag(FlagHalfCarry, (op == ALUOperationAnd))
+		c.setXYFlags(result)
 		c.Registers.A = result
 	}
 }
@@ -82,6 +163,12 @@ func (c *CPU) DoALUOperation(op ALUOperationType, operand uint8) {
 func (c *CPU) DoALUShiftOperation(op ALUShiftOperationType, input uint8) uint8 {
 	var result uint8
 	switch op {
+	case ALUShiftOperationRlc:
+		c.setFlag(FlagCarry, (input&(1<<7)) != 0)
+		result = (input << 1) | (input >> 7)
+	case ALUShiftOperationRrc:
+		c.setFlag(FlagCarry, (input&1) != 0)
+		result = (input >> 1) | (input << 7)
 	case ALUShiftOperationRl:
 		beforeCarry := c.getFlag(FlagCarry)
 		c.setFlag(FlagCarry, (input&(1<<7)) != 0)
@@ -102,7 +189,10 @@ func (c *CPU) DoALUShiftOperation(op ALUShiftOperationType, input uint8) uint8 {
 	case ALUShiftOperationSra:
 		c.setFlag(FlagCarry, (input&1) != 0)
 		result = input >> 1
-		result |= ((input & (1 << 6)) << 1)
+		result |= (input & (1 << 7))
+	case ALUShiftOperationSll:
+		c.setFlag(FlagCarry, (input&(1<<7)) != 0)
+		result = (input << 1) | 1
 	case ALUShiftOperationSrl:
 		c.setFlag(FlagCarry, (input&1) != 0)
 		result = input >> 1
@@ -110,11 +200,91 @@ func (c *CPU) DoALUShiftOperation(op ALUShiftOperationType, input uint8) uint8 {
 		panic("cpu: unknown operation type passed to DoALUShiftOperation")
 	}
 
-	c.setFlag(FlagZero, (result == 0))
-	c.setFlag(FlagParityOverflow, calcParity(result))
-	c.setFlag(FlagSign, (result&(1<<7) != 0))
+	c.setSZPFlags(result)
 	c.setFlag(FlagSubtract, false)
 	c.setFlag(FlagHalfCarry, false)
+	c.setXYFlags(result)
 
 	return result
 }
+
+// rlca, rrca, rla, and rra are like their cb counterparts, but leave the sign, zero, and parity flags alone
+func (c *CPU) DoAccumulatorShiftOperation(op ALUShiftOperationType) {
+	preserved := uint8(FlagSign | FlagZero | FlagParityOverflow)
+	flags := c.Registers.Flag
+	c.Registers.A = c.DoALUShiftOperation(op, c.Registers.A)
+	c.Registers.Flag = (flags & preserved) | (c.Registers.Flag & ^preserved)
+}
+
+// undocumentedSource is where bits 3 and 5 come from, which is the operand for registers but the internal WZ register for memory
+func (c *CPU) DoBitTest(bit uint8, value uint8, undocumentedSource uint8) {
+	bitmask := uint8(1 << bit)
+	bitClear := (value&bitmask == 0)
+
+	c.setFlag(FlagSign, (bit == 7 && !bitClear))
+	c.setFlag(FlagZero, bitClear)
+	c.setFlag(FlagHalfCarry, true)
+	c.setFlag(FlagParityOverflow, bitClear)
+	c.setFlag(FlagSubtract, false)
+	c.setXYFlags(undocumentedSource)
+}
+
+func (c *CPU) DoDecimalAdjust() {
+	a := c.Registers.A
+	correction := uint8(0)
+	carry := c.getFlag(FlagCarry)
+
+	if c.getFlag(FlagHalfCarry) || (a&0x0F) > 0x9 {
+		correction |= 0x06
+	}
+	if carry || a > 0x99 {
+		correction |= 0x60
+		carry = true
+	}
+
+	result := a + correction
+	if c.getFlag(FlagSubtract) {
+		result = a - correction
+	}
+
+	c.setSZPFlags(result)
+	c.setFlag(FlagHalfCarry, ((a^result)&0x10 != 0))
+	c.setFlag(FlagCarry, carry)
+	c.setXYFlags(result)
+	c.Registers.A = result
+}
+
+// ldi/ldd: the undocumented flags come from the transferred byte plus a
+func (c *CPU) setBlockTransferFlags(value uint8, counter uint16) {
+	n := value + c.Registers.A
+	c.setFlag(FlagHalfCarry, false)
+	c.setFlag(FlagParityOverflow, (counter != 0))
+	c.setFlag(FlagSubtract, false)
+	c.setFlag(FlagX, (n&(1<<3) != 0))
+	c.setFlag(FlagY, (n&(1<<1) != 0))
+}
+
+// cpi/cpd: like cp, but the carry is untouched and the undocumented flags come from the result minus the half carry
+func (c *CPU) setBlockCompareFlags(value uint8, counter uint16) {
+	carry := c.getFlag(FlagCarry)
+	result := c.subtract8(c.Registers.A, value, 0)
+	n := result
+	if c.getFlag(FlagHalfCarry) {
+		n -= 1
+	}
+	c.setFlag(FlagParityOverflow, (counter != 0))
+	c.setFlag(FlagCarry, carry)
+	c.setFlag(FlagX, (n&(1<<3) != 0))
+	c.setFlag(FlagY, (n&(1<<1) != 0))
+}
+
+// ini/ind/outi/outd: k is the transferred byte plus whichever 8-bit value the chip happens to add it to
+func (c *CPU) setBlockIOFlags(value uint8, k uint16) {
+	c.setFlag(FlagSign, (c.Registers.B&(1<<7) != 0))
+	c.setFlag(FlagZero, (c.Registers.B == 0))
+	c.setFlag(FlagHalfCarry, (k > 0xFF))
+	c.setFlag(FlagParityOverflow, calcParity((uint8(k)&7)^c.Registers.B))
+	c.setFlag(FlagSubtract, (value&(1<<7) != 0))
+	c.setFlag(FlagCarry, (k > 0xFF))
+	c.setXYFlags(c.Registers.B)
+}
@@ -0,0 +1,102 @@
+package cpu
+
+// the 8080 has no subtract flag or undocumented bits, so bit 1 always reads as 1 and bits 3 and 5 as 0
+const (
+	flagMask8080      = FlagSign | FlagZero | FlagHalfCarry | FlagParityOverflow | FlagCarry
+	flagAlwaysSet8080 = FlagSubtract
+)
+
+func (c *CPU) setFlags8080(result uint8, halfCarry bool, carry bool) {
+	flags := uint8(flagAlwaysSet8080)
+	if result&(1<<7) != 0 {
+		flags |= FlagSign
+	}
+	if result == 0 {
+		flags |= FlagZero
+	}
+	if halfCarry {
+		flags |= FlagHalfCarry
+	}
+	if calcParity(result) {
+		flags |= FlagParityOverflow
+	}
+	if carry {
+		flags |= FlagCarry
+	}
+	c.Registers.Flag = flags
+}
+
+// the 8080 always puts parity in p/v, and subtracts by adding the complement, so its auxiliary carry is the opposite of the z80's half borrow
+func (c *CPU) doALUOperation8080(op ALUOperationType, operand uint8) {
+	a := c.Registers.A
+	result := uint8(0)
+
+	switch op {
+	case ALUOperationAdd, ALUOperationAdc:
+		carry := uint8(0)
+		if op == ALUOperationAdc {
+			carry = c.carryValue()
+		}
+		noOverflowResult := uint16(a) + uint16(operand) + uint16(carry)
+		result = uint8(noOverflowResult)
+		c.setFlags8080(result, (a&0x0F)+(operand&0x0F)+carry > 0x0F, noOverflowResult > 0xFF)
+	case ALUOperationSub, ALUOperationSbc, ALUOperationCp:
+		borrow := uint8(0)
+		if op == ALUOperationSbc {
+			borrow = c.carryValue()
+		}
+		result = a - operand - borrow
+		c.setFlags8080(result, (a&0x0F)+(^operand&0x0F)+(1-borrow) > 0x0F, uint16(a) < uint16(operand)+uint16(borrow))
+	case ALUOperationAnd:
+		result = a & operand
+		c.setFlags8080(result, (a|operand)&0x08 != 0, false)
+	case ALUOperationXor:
+		result = a ^ operand
+		c.setFlags8080(result, false, false)
+	case ALUOperationOr:
+		result = a | operand
+		c.setFlags8080(result, false, false)
+	default:
+		panic("cpu: unknown operation type passed to doALUOperation8080")
+	}
+
+	if op != ALUOperationCp {
+		c.Registers.A = result
+	}
+}
+
+// inr and dcr leave the carry flag alone
+func (c *CPU) increment8080(value uint8) uint8 {
+	result := value + 1
+	c.setFlags8080(result, (result&0x0F) == 0, c.getFlag(FlagCarry))
+	return result
+}
+
+func (c *CPU) decrement8080(value uint8) uint8 {
+	result := value - 1
+	c.setFlags8080(result, (result&0x0F) != 0x0F, c.getFlag(FlagCarry))
+	return result
+}
+
+// rlc, rrc, ral, and rar only change the carry flag
+func (c *CPU) rotateAccumulator8080(op ALUShiftOperationType) {
+	flags := c.Registers.Flag
+	c.DoAccumulatorShiftOperation(op)
+	c.Registers.Flag = (flags & ^uint8(FlagCarry)) | (c.Registers.Flag & FlagCarry)
+}
+
+// there's no subtract flag, so daa only works after additions
+func (c *CPU) decimalAdjust8080() {
+	a := c.Registers.A
+	correction := uint8(0)
+	carry := c.getFlag(FlagCarry)
+	if (a&0x0F) > 9 || c.getFlag(FlagHalfCarry) {
+		correction |= 0x06
+	}
+	if a > 0x99 || carry {
+		correction |= 0x60
+		carry = true
+	}
+	c.Registers.A = a + correction
+	c.setFlags8080(c.Registers.A, (a&0x0F)+(correction&0x0F) > 0x0F, carry)
+}
@@ -0,0 +1,293 @@
+package cpu
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/thatoddmailbox/computer-emu/symbols"
+)
+
+var ErrUnknownInstruction = errors.New("cpu: no instruction matches")
+var ErrOperandOutOfRange = errors.New("cpu: operand out of range")
+
+// the instructions that take a, but where it can be left out, like sub 5 for sub a, 5
+var accumulatorMnemonics = []string{"add", "adc", "sub", "sbc", "and", "xor", "or", "cp"}
+
+// names that are never labels, so that something like ld a, c isn't taken for ld a, n
+var reservedNames = []string{
+	"a", "b", "c", "d", "e", "h", "l", "i", "r", "af", "bc", "de", "hl", "sp", "ix", "iy", "ixh", "ixl", "iyh", "iyl",
+	"nz", "z", "nc", "po", "pe", "p", "m",
+}
+
+type encoding struct {
+	prefix    uint16
+	opcode    uint8
+	info      InstructionInfo
+	templates []string
+}
+
+// every instruction in the disassembly tables by mnemonic, with the one an assembler would pick first
+var encodingsByMnemonic = buildEncodingsByMnemonic()
+
+func buildEncodingsByMnemonic() map[string][]encoding {
+	encodings := map[string][]encoding{}
+	for _, table := range disassemblyTables {
+		for opcode := 0; opcode < 256; opcode++ {
+			info, ok := table.table[uint8(opcode)]
+			if !ok {
+				continue
+			}
+			templates := []string{}
+			if info.Parameters != "" {
+				templates = strings.Split(strings.ReplaceAll(info.Parameters, " ", ""), ",")
+			}
+			encodings[info.Mnemonic] = append(encodings[info.Mnemonic], encoding{table.prefix, uint8(opcode), info, templates})
+		}
+	}
+	return encodings
+}
+
+// evaluate works out a number, a label from s, or a sum of them, like loop+0x3.
+// Numbers can be written as 0x1f, $1f, 1fh, or 31.
+func evaluate(expression string, s *symbols.Symbols) (int, bool) {
+	if expression == "" {
+		return 0, false
+	}
+
+	total := 0
+	sign := 1
+	term := ""
+	for i := 0; i <= len(expression); i++ {
+		if i < len(expression) && expression[i] != '+' && expression[i] != '-' {
+			term += string(expression[i])
+			continue
+		}
+
+		if term == "" {
+			if i == 0 && i < len(expression) {
+				// a leading sign
+				if expression[i] == '-' {
+					sign = -1
+				}
+				continue
+			}
+			return 0, false
+		}
+
+		value, ok := evaluateTerm(term, s)
+		if !ok {
+			return 0, false
+		}
+		total += sign * value
+
+		term = ""
+		if i < len(expression) && expression[i] == '-' {
+			sign = -1
+		} else {
+			sign = 1
+		}
+	}
+	return total, true
+}
+
+// evaluateTerm works out one number or label. Labels keep their case, since that's how they're looked up.
+func evaluateTerm(term string, s *symbols.Symbols) (int, bool) {
+	var value uint64
+	var err error
+	lower := strings.ToLower(term)
+	if strings.HasPrefix(lower, "0x") {
+		value, err = strconv.ParseUint(lower[2:], 16, 16)
+	} else if strings.HasPrefix(lower, "$") {
+		value, err = strconv.ParseUint(lower[1:], 16, 16)
+	} else if len(term) == 3 && term[0] == '\'' && term[2] == '\'' {
+		value = uint64(term[1])
+	} else if term[0] >= '0' && term[0] <= '9' {
+		if strings.HasSuffix(lower, "h") {
+			value, err = strconv.ParseUint(lower[:len(lower)-1], 16, 16)
+		} else {
+			value, err = strconv.ParseUint(lower, 10, 16)
+		}
+	} else {
+		for _, name := range reservedNames {
+			if lower == name {
+				return 0, false
+			}
+		}
+		address, ok := s.Resolve(term)
+		return int(address), ok
+	}
+	return int(value), err == nil
+}
+
+// matchOperand checks operand against one of an instruction's operand templates, returning the bytes it adds.
+// Registers and conditions can be any case, but labels are left as they are.
+func matchOperand(mnemonic string, template string, operand string, s *symbols.Symbols, next uint16) ([]byte, bool, error) {
+	lower := strings.ToLower(operand)
+	switch {
+	case strings.Contains(template, "+%d"):
+		// [ix+%d8], or [ix+%ds8]->b
+		register := template[1:strings.Index(template, "+")]
+		suffix := template[strings.Index(template, "]")+1:]
+		if !strings.HasPrefix(lower, "["+register) || !strings.HasSuffix(lower, "]"+suffix) {
+			return nil, false, nil
+		}
+		displacementText := operand[len(register)+1 : len(operand)-len(suffix)-1]
+		displacement := 0
+		if displacementText != "" {
+			if displacementText[0] != '+' && displacementText[0] != '-' {
+				return nil, false, nil
+			}
+			var ok bool
+			displacement, ok = evaluate(strings.TrimPrefix(displacementText, "+"), s)
+			if !ok {
+				return nil, false, nil
+			}
+		}
+		if displacement < -128 || displacement > 127 {
+			return nil, false, ErrOperandOutOfRange
+		}
+		return []byte{uint8(int8(displacement))}, true, nil
+
+	case template == "[%d16]" || template == "[%d8]":
+		if !strings.HasPrefix(operand, "[") || !strings.HasSuffix(operand, "]") {
+			return nil, false, nil
+		}
+		return matchOperand(mnemonic, template[1:len(template)-1], operand[1:len(operand)-1], s, next)
+
+	case template == "%d16":
+		value, ok := evaluate(operand, s)
+		if !ok {
+			return nil, false, nil
+		}
+		if value < -0x8000 || value > 0xFFFF {
+			return nil, false, ErrOperandOutOfRange
+		}
+		return []byte{uint8(value), uint8(value >> 8)}, true, nil
+
+	case template == "%d8":
+		value, ok := evaluate(operand, s)
+		if !ok {
+			return nil, false, nil
+		}
+		if mnemonic == "jr" || mnemonic == "djnz" {
+			// the operand is where it goes, relative to the next instruction
+			value -= int(next)
+			if value < -128 || value > 127 {
+				return nil, false, ErrOperandOutOfRange
+			}
+		} else if value < -128 || value > 0xFF {
+			return nil, false, ErrOperandOutOfRange
+		}
+		return []byte{uint8(value)}, true, nil
+	}
+
+	if lower == template {
+		return []byte{}, true, nil
+	}
+	if mnemonic == "jp" && strings.Trim(lower, "[]") == strings.Trim(template, "[]") {
+		// jp (hl) and jp hl are the same thing
+		return []byte{}, true, nil
+	}
+	// fixed numbers, like rst 0x38, im 1, or bit 7, can be written any way
+	templateValue, templateIsNumber := evaluate(template, nil)
+	operandValue, operandIsNumber := evaluate(operand, nil)
+	if templateIsNumber && operandIsNumber && templateValue == operandValue {
+		return []byte{}, true, nil
+	}
+	return nil, false, nil
+}
+
+// assembleEncoding tries to assemble the operands with one encoding
+func assembleEncoding(e encoding, operands []string, address uint16, s *symbols.Symbols) ([]byte, bool, error) {
+	if len(operands) != len(e.templates) {
+		return nil, false, nil
+	}
+
+	prefixBytes := []byte{}
+	switch {
+	case e.prefix > 0xFF:
+		prefixBytes = []byte{uint8(e.prefix >> 8), uint8(e.prefix)}
+	case e.prefix != 0:
+		prefixBytes = []byte{uint8(e.prefix)}
+	}
+	length := len(prefixBytes) + 1 + int(e.info.DataBytes)
+	if e.prefix > 0xFF {
+		// the displacement's counted in DataBytes, and the opcode comes after it
+		length = 4
+	}
+	next := address + uint16(length)
+
+	data := []byte{}
+	for i, template := range e.templates {
+		operandData, ok, err := matchOperand(e.info.Mnemonic, template, operands[i], s, next)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		data = append(data, operandData...)
+	}
+
+	if e.prefix > 0xFF {
+		return append(append(prefixBytes, data...), e.opcode), true, nil
+	}
+	return append(append(prefixBytes, e.opcode), data...), true, nil
+}
+
+// Assemble turns one line of assembly, like ld a, (ix+5), into the bytes for the instruction at address.
+// Brackets and parentheses both work for memory operands, and labels are looked up in s, which can be nil.
+func Assemble(line string, address uint16, s *symbols.Symbols) ([]byte, error) {
+	if comment := strings.Index(line, ";"); comment != -1 {
+		line = line[:comment]
+	}
+	line = strings.TrimSpace(line)
+
+	mnemonic := line
+	operandText := ""
+	if space := strings.IndexAny(line, " \t"); space != -1 {
+		mnemonic = line[:space]
+		operandText = line[space+1:]
+	}
+	mnemonic = strings.ToLower(mnemonic)
+
+	operands := []string{}
+	if strings.TrimSpace(operandText) != "" {
+		for _, operand := range strings.Split(operandText, ",") {
+			operand = strings.Join(strings.Fields(operand), "")
+			operand = strings.NewReplacer("(", "[", ")", "]").Replace(operand)
+			operands = append(operands, operand)
+		}
+	}
+
+	attempts := [][]string{operands}
+	for _, accumulatorMnemonic := range accumulatorMnemonics {
+		if mnemonic != accumulatorMnemonic {
+			continue
+		}
+		if len(operands) == 2 && strings.ToLower(operands[0]) == "a" {
+			attempts = append(attempts, operands[1:])
+		} else if len(operands) == 1 {
+			attempts = append(attempts, []string{"a", operands[0]})
+		}
+	}
+
+	var rangeErr error
+	for _, attempt := range attempts {
+		for _, e := range encodingsByMnemonic[mnemonic] {
+			assembled, ok, err := assembleEncoding(e, attempt, address, s)
+			if err != nil {
+				// something else might still fit, like a 16 bit version
+				rangeErr = err
+				continue
+			}
+			if ok {
+				return assembled, nil
+			}
+		}
+	}
+
+	if rangeErr != nil {
+		return nil, fmt.Errorf("%w: %s", rangeErr, line)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownInstruction, line)
+}
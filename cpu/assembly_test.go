@@ -0,0 +1,120 @@
+package cpu
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/thatoddmailbox/computer-emu/symbols"
+)
+
+// every instruction an assembler would pick should assemble back to the same bytes it was disassembled from
+func TestAssembleRoundTrip(t *testing.T) {
+	for _, table := range disassemblyTables {
+		for opcode := 0; opcode < 256; opcode++ {
+			if _, ok := table.table[uint8(opcode)]; !ok {
+				continue
+			}
+
+			// with operands that don't look like anything else
+			var code []byte
+			switch {
+			case table.prefix > 0xFF:
+				code = []byte{uint8(table.prefix >> 8), 0xCB, 0xF6, uint8(opcode)}
+			case table.prefix != 0:
+				code = []byte{uint8(table.prefix), uint8(opcode), 0x85, 0x12}
+			default:
+				code = []byte{uint8(opcode), 0x85, 0x12}
+			}
+
+			instruction, err := Disassemble(code, 0x4000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !instruction.Canonical() {
+				continue
+			}
+
+			assembled, err := Assemble(instruction.String(), 0x4000, nil)
+			if err != nil {
+				t.Errorf("%s (% X): %v", instruction, instruction.Bytes, err)
+			} else if !bytes.Equal(assembled, instruction.Bytes) {
+				t.Errorf("%s assembled to % X, expected % X", instruction, assembled, instruction.Bytes)
+			}
+		}
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	s := &symbols.Symbols{}
+	s.Add(&symbols.Table{
+		Start: 0x0000,
+		End:   0xFFFF,
+		Symbols: []symbols.Symbol{
+			{Name: "PrintString", Address: 0x0800},
+			{Name: "loop", Address: 0x1000},
+		},
+	})
+
+	tests := []struct {
+		line     string
+		address  uint16
+		expected []byte
+	}{
+		{"ld a, (ix+5)", 0x0000, []byte{0xDD, 0x7E, 0x05}},
+		{"ld a, (ix-5)", 0x0000, []byte{0xDD, 0x7E, 0xFB}},
+		{"LD A, [IY-0x80]", 0x0000, []byte{0xFD, 0x7E, 0x80}},
+		{"ld (ix), 0x42", 0x0000, []byte{0xDD, 0x36, 0x00, 0x42}},
+		{"bit 7, (ix+1)", 0x0000, []byte{0xDD, 0xCB, 0x01, 0x7E}},
+		{"sub 5", 0x0000, []byte{0xD6, 0x05}},
+		{"sub a, 5", 0x0000, []byte{0xD6, 0x05}},
+		{"and b", 0x0000, []byte{0xA0}},
+		{"ld a, c", 0x0000, []byte{0x79}},
+		{"ld a, 'A'", 0x0000, []byte{0x3E, 0x41}},
+		{"rst 38h", 0x0000, []byte{0xFF}},
+		{"jp (hl)", 0x0000, []byte{0xE9}},
+		{"ex af, af'", 0x0000, []byte{0x08}},
+		{"sll b", 0x0000, []byte{0xCB, 0x30}},
+		{"sll (ix+2)", 0x0000, []byte{0xDD, 0xCB, 0x02, 0x36}},
+		{"jr loop", 0x1010, []byte{0x18, 0xEE}},
+		{"djnz loop", 0x0F90, []byte{0x10, 0x6E}},
+		{"call PrintString", 0x0000, []byte{0xCD, 0x00, 0x08}},
+		{"jp loop+0x3", 0x0000, []byte{0xC3, 0x03, 0x10}},
+		{"ld hl, (loop)", 0x0000, []byte{0x2A, 0x00, 0x10}},
+		{"ld (0x1234), hl", 0x0000, []byte{0x22, 0x34, 0x12}},
+		{"ld (0x1234), de", 0x0000, []byte{0xED, 0x53, 0x34, 0x12}},
+		{"nop ; comment", 0x0000, []byte{0x00}},
+	}
+	for _, test := range tests {
+		assembled, err := Assemble(test.line, test.address, s)
+		if err != nil {
+			t.Errorf("%s: %v", test.line, err)
+		} else if !bytes.Equal(assembled, test.expected) {
+			t.Errorf("%s assembled to % X, expected % X", test.line, assembled, test.expected)
+		}
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		line     string
+		address  uint16
+		expected error
+	}{
+		{"jr 0x1000", 0x0000, ErrOperandOutOfRange},
+		{"jr 0x0000", 0x0100, ErrOperandOutOfRange},
+		{"djnz 0x0082", 0x0000, ErrOperandOutOfRange},
+		{"ld a, (ix+128)", 0x0000, ErrOperandOutOfRange},
+		{"ld a, 0x100", 0x0000, ErrOperandOutOfRange},
+		{"frob a", 0x0000, ErrUnknownInstruction},
+		// there's nothing that stores just h
+		{"ld (0x1234), h", 0x0000, ErrUnknownInstruction},
+		{"call nowhere", 0x0000, ErrUnknownInstruction},
+	}
+	for _, test := range tests {
+		_, err := Assemble(test.line, test.address, nil)
+		if !errors.Is(err, test.expected) {
+			t.Errorf("%s: got %v, expected %v", test.line, err, test.expected)
+		}
+	}
+}
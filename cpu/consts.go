@@ -1,11 +1,17 @@
 package cpu
 
+type CPUVariantType int
 type ALUOperationType int
 type ALUShiftOperationType int
 type ConditionCodeType int
 type Register8bitType int
 type RegisterPairType int
 
+const (
+	CPUVariantZ80 CPUVariantType = iota
+	CPUVariant8080 // also the KR580VM80A
+)
+
 const (
 	ALUOperationAdd ALUOperationType = iota
 	ALUOperationAdc
@@ -48,6 +54,10 @@ const (
 	RegisterH
 	RegisterL
 	RegisterIndirectHL
+	RegisterIXH
+	RegisterIXL
+	RegisterIYH
+	RegisterIYL
 )
 
 const (
@@ -56,12 +66,16 @@ const (
 	RegisterPairDE
 	RegisterPairHL
 	RegisterPairSP
+	RegisterPairIX
+	RegisterPairIY
 )
 
 const (
 	FlagSign = (1 << 7)
 	FlagZero = (1 << 6)
+	FlagY = (1 << 5)
 	FlagHalfCarry = (1 << 4)
+	FlagX = (1 << 3)
 	FlagParityOverflow = (1 << 2)
 	FlagSubtract = (1 << 1)
 	FlagCarry = (1 << 0)
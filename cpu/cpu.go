@@ -2,18 +2,83 @@ package cpu
 
 import (
 	"errors"
-	"log"
+	"fmt"
 
 	"github.com/thatoddmailbox/computer-emu/bus"
+	"github.com/thatoddmailbox/computer-emu/symbols"
 )
 
 var ErrNotImplemented = errors.New("cpu: instruction not implemented")
+var ErrUndocumented = errors.New("cpu: undocumented instruction in strict mode")
+
+// ExecutionError is returned by Step when an instruction couldn't be executed, wrapping ErrNotImplemented, ErrUndocumented, or a *bus.AccessError.
+// PC is left pointing at the instruction. ErrNotImplemented and ErrUndocumented are found before the instruction runs, so nothing else has changed,
+// but with a *bus.AccessError, anything the instruction did before the failure has already happened, like writes to memory and reads from IO devices.
+// The cpu is then only good for looking at, like in the debugger, since stepping again would do those things twice.
+type ExecutionError struct {
+	PC uint16
+
+	// 0 if there wasn't one, otherwise 0xCB, 0xED, 0xDD, 0xFD, 0xDDCB, or 0xFDCB
+	Prefix uint16
+
+	// the prefix, opcode, and any operands that were read
+	Bytes []byte
+
+	Err error
+}
+
+func (e *ExecutionError) Error() string {
+	return fmt.Sprintf("%v (PC: 0x%04X, bytes: % X)", e.Err, e.PC, e.Bytes)
+}
+
+func (e *ExecutionError) Unwrap() error {
+	return e.Err
+}
+
+// ExecutionObserver is told about everything the cpu runs, for profiling and coverage.
+type ExecutionObserver interface {
+	// Executed is called after each instruction, with its address, its length including any prefixes, and how many t-states it took.
+	// The length is 0 when there wasn't an instruction, like when halted.
+	Executed(pc uint16, length uint16, cycles uint64)
+
+	// Called is called when a call or rst is taken, or an interrupt is accepted, with where it went.
+	// For calls, it comes after Executed, and for interrupts, it comes before Executed for the t-states accepting it took.
+	Called(target uint16)
+
+	// Returned is called after Executed when a ret is taken
+	Returned()
+}
 
 type CPU struct {
+	Variant CPUVariantType
+
+	// refuse to run undocumented instructions, returning ErrUndocumented instead
+	Strict bool
+
 	Bus             bus.EmulatorBus
 	Registers       RegisterFile
 	ShadowRegisters RegisterFile
 	PC              uint16
+
+	IFF1          bool
+	IFF2          bool
+	InterruptMode uint8
+	EIDelay       bool
+	Halted        bool
+
+	// internal register, also called MEMPTR, which only shows up in the undocumented flags
+	WZ uint16
+
+	// t-states executed since the cpu was created
+	Cycles uint64
+
+	// empty unless something's profiling or measuring coverage
+	Observers []ExecutionObserver
+
+	// labels for addresses in the disassembly, or nil to show them as numbers
+	Symbols *symbols.Symbols
+
+	instruction instructionState
 }
 
 type RegisterFile struct {
@@ -28,6 +93,8 @@ type RegisterFile struct {
 	SP   uint16
 	IX   uint16
 	IY   uint16
+	I    uint8
+	R    uint8
 }
 
 func (c *CPU) ConditionMet(condition ConditionCodeType) bool {
@@ -64,489 +131,186 @@ func (c *CPU) Pop() uint8 {
 	return data
 }
 
+func (c *CPU) pushWord(value uint16) {
+	c.Push(uint8((value & 0xFF00) >> 8))
+	c.Push(uint8(value & 0xFF))
+}
+
+func (c *CPU) popWord() uint16 {
+	low := c.Pop()
+	high := c.Pop()
+	return registerPair(high, low)
+}
+
+// the refresh register counts m1 cycles, but only in the low 7 bits
+func (c *CPU) incrementRefresh(amount uint8) {
+	if c.Variant == CPUVariant8080 {
+		// there's no refresh register
+		return
+	}
+	c.Registers.R = (c.Registers.R & 0x80) | ((c.Registers.R + amount) & 0x7F)
+}
+
 func (c *CPU) Step(breakpointTrigger func()) error {
-	instruction := c.Bus.ReadMemoryByte(c.PC)
-	instructionLength := 1
-
-	prefix := uint16(0)
-
-	if instruction == 0xCB {
-		prefix = 0xCB
-		instructionLength += 1
-	} else if instruction == 0xED {
-		prefix = 0xED
-		instructionLength += 1
-	} else if instruction == 0xDD {
-		prefix = 0xDD
-		instructionLength += 1
-		if c.Bus.ReadMemoryByte(c.PC+1) == 0xCB {
-			prefix = 0xDDCB
-			instructionLength += 1
-		}
-	} else if instruction == 0xFD {
-		prefix = 0xFD
-		instructionLength += 1
-		if c.Bus.ReadMemoryByte(c.PC+1) == 0xCB {
-			prefix = 0xFDCB
-			instructionLength += 1
+	c.instruction = instructionState{
+		breakpointTrigger: breakpointTrigger,
+	}
+
+	// anything left over is from something else looking at memory, like the debugger
+	c.Bus.TakeFault()
+	c.Bus.TakeWaitStates()
+
+	startCycles := c.Cycles
+
+	if c.Variant != CPUVariant8080 && c.Bus.TakeNMI() {
+		c.acceptNMI()
+		c.Cycles += c.Bus.TakeWaitStates()
+		c.observeInterrupt(startCycles)
+		return c.checkFault()
+	}
+	if c.EIDelay {
+		// interrupts aren't accepted until after the instruction following ei
+		c.EIDelay = false
+	} else if c.IFF1 && c.Bus.InterruptRequested() {
+		err := c.acceptInterrupt()
+		if err != nil {
+			return err
 		}
+		c.Cycles += c.Bus.TakeWaitStates()
+		c.observeInterrupt(startCycles)
+		return c.checkFault()
 	}
 
-	if instructionLength > 1 {
-		instruction = c.Bus.ReadMemoryByte(c.PC + uint16(instructionLength) - 1)
+	if c.Halted {
+		// halt executes nops until an interrupt comes along
+		c.incrementRefresh(1)
+		c.Cycles += 4
+		c.observe(c.PC, 0, startCycles)
+		return nil
 	}
 
-	x := (instruction & 0xC0) >> 6 // 0b11000000
-	y := (instruction & 0x38) >> 3 // 0b00111000
-	z := (instruction & 0x07)      // 0b00000111
-	p := y >> 1
-	q := y % 2
-
-	validInstruction := false
-	shouldIncrementPC := true
-
-	if prefix == 0 {
-		if x == 0 {
-			if z == 0 {
-				if y == 0 {
-					// nop
-					validInstruction = true
-				}
-				// TODO: y: [1, 7]
-			} else if z == 1 {
-				if q == 0 {
-					// ld rp[p], nn
-					validInstruction = true
-					c.Set16bitRegister(DecodeTable_RP[p], registerPair(c.Bus.ReadMemoryByte(c.PC+2), c.Bus.ReadMemoryByte(c.PC+1)))
-					instructionLength += 2
-				} else if q == 1 {
-					// add hl, rp[p]
-					validInstruction = true
-					hl := c.Get16bitRegister(RegisterPairHL)
-					operand := c.Get16bitRegister(DecodeTable_RP[p])
-					result := hl + operand
-					resultNoOverflow := uint32(hl) + uint32(operand)
-					c.Set16bitRegister(RegisterPairHL, result)
-					c.setFlag(FlagCarry, (resultNoOverflow&(1<<16) != 0))
-				}
-			} else if z == 2 {
-				if q == 0 {
-					if p == 0 {
-						// ld [bc], a
-						validInstruction = true
-						c.Bus.WriteMemoryByte(registerPair(c.Registers.B, c.Registers.C), c.Registers.A)
-					} else if p == 1 {
-						// ld [de], a
-						validInstruction = true
-						c.Bus.WriteMemoryByte(registerPair(c.Registers.D, c.Registers.E), c.Registers.A)
-					} else if p == 2 {
-						// ld [nn], hl
-						validInstruction = true
-						c.Bus.WriteMemoryByte(registerPair(c.Bus.ReadMemoryByte(c.PC+2), c.Bus.ReadMemoryByte(c.PC+1)), c.Registers.L)
-						c.Bus.WriteMemoryByte(registerPair(c.Bus.ReadMemoryByte(c.PC+2), c.Bus.ReadMemoryByte(c.PC+1))+1, c.Registers.H)
-						instructionLength += 2
-					} else if p == 3 {
-						// ld [nn], a
-						validInstruction = true
-						c.Bus.WriteMemoryByte(registerPair(c.Bus.ReadMemoryByte(c.PC+2), c.Bus.ReadMemoryByte(c.PC+1)), c.Registers.A)
-						instructionLength += 2
-					}
-				} else if q == 1 {
-					if p == 0 {
-						// ld a, [bc]
-						validInstruction = true
-						c.Registers.A = c.Bus.ReadMemoryByte(registerPair(c.Registers.B, c.Registers.C))
-					} else if p == 1 {
-						// ld a, [de]
-						validInstruction = true
-						c.Registers.A = c.Bus.ReadMemoryByte(registerPair(c.Registers.D, c.Registers.E))
-					} else if p == 2 {
-						// ld hl, [nn]
-						validInstruction = true
-						c.Registers.L = c.Bus.ReadMemoryByte(registerPair(c.Bus.ReadMemoryByte(c.PC+2), c.Bus.ReadMemoryByte(c.PC+1)))
-						c.Registers.H = c.Bus.ReadMemoryByte(registerPair(c.Bus.ReadMemoryByte(c.PC+2), c.Bus.ReadMemoryByte(c.PC+1)) + 1)
-						instructionLength += 2
-					} else if p == 3 {
-						// ld a, [nn]
-						validInstruction = true
-						c.Registers.A = c.Bus.ReadMemoryByte(registerPair(c.Bus.ReadMemoryByte(c.PC+2), c.Bus.ReadMemoryByte(c.PC+1)))
-						instructionLength += 2
-					}
-				}
-			} else if z == 3 {
-				if q == 0 {
-					// inc rp[p]
-					validInstruction = true
-					c.Set16bitRegister(DecodeTable_RP[p], c.Get16bitRegister(DecodeTable_RP[p])+1)
-				} else if q == 1 {
-					// dec rp[p]
-					validInstruction = true
-					c.Set16bitRegister(DecodeTable_RP[p], c.Get16bitRegister(DecodeTable_RP[p])-1)
-				}
-			} else if z == 4 {
-				// inc r[y]
-				validInstruction = true
-				orig := c.Get8bitRegister(DecodeTable_R[y])
-				c.Set8bitRegister(DecodeTable_R[y], c.Add8WithFlags(orig, 1))
-			} else if z == 5 {
-				// dec r[y]
-				validInstruction = true
-				orig := c.Get8bitRegister(DecodeTable_R[y])
-				c.Set8bitRegister(DecodeTable_R[y], c.Subtract8WithFlags(orig, 1))
-			} else if z == 6 {
-				// ld r[y], n
-				validInstruction = true
-				c.Set8bitRegister(DecodeTable_R[y], c.Bus.ReadMemoryByte(c.PC+1))
-				instructionLength += 1
-			} else if z == 7 {
-				if y == 0 {
-					// rlca
-					validInstruction = true
-					msb := c.Registers.A & (1 << 7)
-					c.setFlag(FlagCarry, msb != 0)
-					c.Registers.A = c.Registers.A << 1
-					if msb != 0 {
-						c.Registers.A |= 1
-					}
-				} else if y == 1 {
-					// TODO
-				} else if y == 2 {
-					// rla
-					validInstruction = true
-					msb := c.Registers.A & (1 << 7)
-					c.Registers.A = c.Registers.A << 1
-					if c.getFlag(FlagCarry) {
-						c.Registers.A |= 1
-					}
-					c.setFlag(FlagCarry, msb != 0)
-				} else if y == 3 {
-					// rra
-					validInstruction = true
-					lsb := c.Registers.A & 1
-					c.Registers.A = c.Registers.A >> 1
-					if c.getFlag(FlagCarry) {
-						c.Registers.A |= (1 << 7)
-					}
-					c.setFlag(FlagCarry, lsb != 0)
-				} else if y == 4 {
-					// daa
-					validInstruction = true
-					addAmount := uint8(0)
-					if c.getFlag(FlagHalfCarry) || (c.Registers.A&0xF) > 0x9 {
-						addAmount += 0x6
-					}
-					if c.getFlag(FlagCarry) || (c.Registers.A&0xF0) > 0x90 {
-						addAmount += 0x60
-					}
-					c.Registers.A = c.Add8WithFlags(c.Registers.A, addAmount)
-				} else if y == 5 {
-					// cpl
-					validInstruction = true
-					c.Registers.A = ^c.Registers.A
-				} else if y == 6 {
-					// scf
-					validInstruction = true
-					c.setFlag(FlagCarry, true)
-					c.setFlag(FlagSubtract, false)
-				} else if y == 7 {
-					// ccf
-					validInstruction = true
-					c.setFlag(FlagCarry, !c.getFlag(FlagCarry))
-					c.setFlag(FlagSubtract, false)
-				}
-			}
-		} else if x == 1 {
-			if z == 6 && y == 6 {
-				// halt
-				// TODO
-			} else {
-				// ld r[y], r[z]
-				validInstruction = true
-				target := DecodeTable_R[y]
-				source := DecodeTable_R[z]
-				if target == RegisterB && source == RegisterB {
-					// it's a breakpoint
-					breakpointTrigger()
-				}
-				c.Set8bitRegister(target, c.Get8bitRegister(source))
-			}
-		} else if x == 2 {
-			// alu[y] r[z]
-			validInstruction = true
-			operation := DecodeTable_ALU[y]
-			operand := DecodeTable_R[z]
-			c.DoALUOperation(operation, c.Get8bitRegister(operand))
-		} else if x == 3 {
-			if z == 0 {
-				// ret cc[y]
-				validInstruction = true
-				if c.ConditionMet(DecodeTable_CC[y]) {
-					low := c.Pop()
-					high := c.Pop()
-					c.PC = (uint16(high) << 8) | uint16(low)
-					shouldIncrementPC = false
-				}
-			} else if z == 1 {
-				if q == 0 {
-					// pop rp2[p]
-					validInstruction = true
-					low := c.Pop()
-					high := c.Pop()
-					value := (uint16(high) << 8) | uint16(low)
-					c.Set16bitRegister(DecodeTable_RP2[p], value)
-				} else if q == 1 {
-					if p == 0 {
-						// ret
-						validInstruction = true
-						low := c.Pop()
-						high := c.Pop()
-						c.PC = (uint16(high) << 8) | uint16(low)
-						shouldIncrementPC = false
-					} else if p == 1 {
-						// exx
-						validInstruction = true
-
-						c.Swap8bitRegisterWithShadow(RegisterB)
-						c.Swap8bitRegisterWithShadow(RegisterC)
-
-						c.Swap8bitRegisterWithShadow(RegisterD)
-						c.Swap8bitRegisterWithShadow(RegisterE)
-
-						c.Swap8bitRegisterWithShadow(RegisterH)
-						c.Swap8bitRegisterWithShadow(RegisterL)
-					} else if p == 2 {
-						// jp hl
-						validInstruction = true
-						c.PC = registerPair(c.Registers.H, c.Registers.L)
-						shouldIncrementPC = false
-					} else if p == 3 {
-						// TODO
-					}
-				}
-			} else if z == 2 {
-				// jp cc[y], nn
-				validInstruction = true
-				if c.ConditionMet(DecodeTable_CC[y]) {
-					c.PC = registerPair(c.Bus.ReadMemoryByte(c.PC+2), c.Bus.ReadMemoryByte(c.PC+1))
-					shouldIncrementPC = false
-				}
-				instructionLength += 2
-			} else if z == 3 {
-				if y == 0 {
-					// jp nn
-					validInstruction = true
-					c.PC = registerPair(c.Bus.ReadMemoryByte(c.PC+2), c.Bus.ReadMemoryByte(c.PC+1))
-					shouldIncrementPC = false
-					instructionLength += 2
-				} else if y == 1 {
-					// TODO
-				} else if y == 2 {
-					// out [n], a
-					validInstruction = true
-					c.Bus.WriteIOByte(c.Bus.ReadMemoryByte(c.PC+1), c.Registers.A)
-					instructionLength += 1
-				} else if y == 3 {
-					// in a, [n]
-					validInstruction = true
-					c.Registers.A = c.Bus.ReadIOByte(c.Bus.ReadMemoryByte(c.PC + 1))
-					instructionLength += 1
-				} else if y == 4 {
-					// ex [sp], hl
-					validInstruction = true
-					swapHigh := c.Bus.ReadMemoryByte(c.Registers.SP + 1)
-					swapLow := c.Bus.ReadMemoryByte(c.Registers.SP)
-					c.Bus.WriteMemoryByte(c.Registers.SP+1, c.Registers.H)
-					c.Bus.WriteMemoryByte(c.Registers.SP, c.Registers.L)
-					c.Registers.H = swapHigh
-					c.Registers.L = swapLow
-				} else if y == 5 {
-					// ex de, hl
-					validInstruction = true
-					swapHigh := c.Registers.D
-					swapLow := c.Registers.E
-					c.Registers.D = c.Registers.H
-					c.Registers.E = c.Registers.L
-					c.Registers.H = swapHigh
-					c.Registers.L = swapLow
-				} else if y == 6 {
-					// di
-					validInstruction = true
-					// interrupts are not used, so no-op
-				} else if y == 7 {
-					// ei
-					validInstruction = true
-					// interrupts are not used, so no-op
-				}
-			} else if z == 4 {
-				// call cc[y], nn
-				validInstruction = true
-
-				if c.ConditionMet(DecodeTable_CC[y]) {
-					returnAddress := c.PC + 3
-					c.Push(uint8((returnAddress & 0xFF00) >> 8))
-					c.Push(uint8(returnAddress & 0xFF))
-
-					c.PC = registerPair(c.Bus.ReadMemoryByte(c.PC+2), c.Bus.ReadMemoryByte(c.PC+1))
-					shouldIncrementPC = false
-				}
-
-				instructionLength += 2
-			} else if z == 5 {
-				if q == 0 {
-					// push rp2[p]
-					validInstruction = true
-					value := c.Get16bitRegister(DecodeTable_RP2[p])
-					c.Push(uint8((value & 0xFF00) >> 8))
-					c.Push(uint8(value & 0xFF))
-				} else if q == 1 {
-					if p == 0 {
-						// call nn
-						validInstruction = true
-
-						returnAddress := c.PC + 3
-						c.Push(uint8((returnAddress & 0xFF00) >> 8))
-						c.Push(uint8(returnAddress & 0xFF))
-
-						c.PC = registerPair(c.Bus.ReadMemoryByte(c.PC+2), c.Bus.ReadMemoryByte(c.PC+1))
-						shouldIncrementPC = false
-
-						instructionLength += 2
-					}
-					// if p != 0 and we're here, it's a prefix which should have been caught earlier
-					// so just ignore it
-				}
-			} else if z == 6 {
-				// alu[y] n
-				validInstruction = true
-				operation := DecodeTable_ALU[y]
-				operand := c.Bus.ReadMemoryByte(c.PC + 1)
-				c.DoALUOperation(operation, operand)
-				instructionLength += 1
-			} else if z == 7 {
-				// rst y*8
-				validInstruction = true
-				returnAddress := c.PC + 1
-				c.Push(uint8((returnAddress & 0xFF00) >> 8))
-				c.Push(uint8(returnAddress & 0xFF))
-				c.PC = uint16(y) * 8
-				shouldIncrementPC = false
+	c.instruction.length = 1
+	table := &opcodeTable_Unprefixed
+
+	// put back if the instruction can't be run, so that nothing has changed
+	refresh := c.Registers.R
+
+	opcode := c.Bus.ReadMemoryByte(c.PC)
+	if c.Variant == CPUVariant8080 {
+		// the 8080 doesn't have any prefixes
+		table = &opcodeTable_8080
+	} else {
+		switch opcode {
+		case 0xCB:
+			c.instruction.prefix = 0xCB
+			table = &opcodeTable_CB
+		case 0xED:
+			c.instruction.prefix = 0xED
+			table = &opcodeTable_ED
+		case 0xDD, 0xFD:
+			next := c.Bus.ReadMemoryByte(c.PC + 1)
+			if next == 0xDD || next == 0xED || next == 0xFD {
+				// undocumented: the prefix has nothing to apply to, so it acts like a nop
+				table = &opcodeTable_IgnoredPrefix
+				break
 			}
-		}
-	} else if prefix == 0xCB {
-		if x == 0 {
-			// rot[y] r[z]
-			validInstruction = true
-			operation := DecodeTable_ROT[y]
-			operand := DecodeTable_R[z]
-			value := c.Get8bitRegister(operand)
-			result := c.DoALUShiftOperation(operation, value)
-			c.Set8bitRegister(operand, result)
-		} else if x == 1 {
-			// bit y, r[z]
-			validInstruction = true
-			operand := DecodeTable_R[z]
-			value := c.Get8bitRegister(operand)
-			bitmask := uint8(1 << y)
-
-			c.setFlag(FlagHalfCarry, true)
-			c.setFlag(FlagSubtract, false)
-
-			if value&bitmask == 0 {
-				c.setFlag(FlagZero, true)
-			} else {
-				c.setFlag(FlagZero, false)
-			}
-		}
-	} else if prefix == 0xED {
-		if x == 1 {
-			if z == 2 {
-				if q == 0 {
-					// sbc hl, rp[p]
-					validInstruction = true
-					orig := c.Get16bitRegister(RegisterPairHL)
-					amount := c.Get16bitRegister(DecodeTable_RP[p])
-					c.Set16bitRegister(RegisterPairHL, c.Subtract16WithFlags(orig, amount))
-				}
+
+			c.instruction.prefix = uint16(opcode)
+			c.instruction.indexRegister = RegisterPairIX
+			if opcode == 0xFD {
+				c.instruction.indexRegister = RegisterPairIY
 			}
-		} else if x == 2 {
-			// bli[y,z]
-			if y > 3 {
-				increment := true
-				repeat := false
-				if y == 4 {
-					increment = true
-				} else if y == 5 {
-					increment = false
-				} else if y == 6 {
-					increment = true
-					repeat = true
-				} else if y == 7 {
-					increment = false
-					repeat = true
-				}
-
-				if z == 0 {
-					// ld
-					validInstruction = true
-					fromAddress := c.Get16bitRegister(RegisterPairHL)
-					toAddress := c.Get16bitRegister(RegisterPairDE)
-					counter := c.Get16bitRegister(RegisterPairBC)
-
-					for {
-						// copy the data
-						dataByte := c.Bus.ReadMemoryByte(fromAddress)
-						// log.Printf("0x%x -> 0x%x (0x%x)", fromAddress, toAddress, dataByte)
-						c.Bus.WriteMemoryByte(toAddress, dataByte)
-
-						if increment {
-							fromAddress = fromAddress + 1
-							toAddress = toAddress + 1
-						} else {
-							fromAddress = fromAddress - 1
-							toAddress = toAddress - 1
-						}
-						counter = counter - 1
-
-						c.setFlag(FlagHalfCarry, false)
-						c.setFlag(FlagSubtract, false)
-						if counter-1 == 0 {
-							c.setFlag(FlagParityOverflow, false)
-						} else {
-							c.setFlag(FlagParityOverflow, true)
-						}
-
-						c.Set16bitRegister(RegisterPairHL, fromAddress)
-						c.Set16bitRegister(RegisterPairDE, toAddress)
-						c.Set16bitRegister(RegisterPairBC, counter)
-
-						if !repeat {
-							break
-						}
-						if counter == 0 {
-							break
-						}
-					}
-				} else if z == 1 {
-					// cp
-					validInstruction = true
-				} else if z == 2 {
-					// in
-				} else if z == 3 {
-					// out
-				}
+			table = &opcodeTable_DD
+			if next == 0xCB {
+				c.instruction.prefix = (c.instruction.prefix << 8) | 0xCB
+				table = &opcodeTable_DDCB
+				// the displacement comes before the opcode
+				c.instruction.length += 2
 			}
 		}
 	}
 
-	if validInstruction && shouldIncrementPC {
-		c.PC += uint16(instructionLength)
+	// there's one m1 cycle for the opcode, and one more for the prefix
+	// (with ddcb and fdcb, the opcode is read like the displacement is, so it doesn't count)
+	if c.instruction.prefix == 0 {
+		c.incrementRefresh(1)
+	} else {
+		c.incrementRefresh(2)
+		opcode = c.fetchOperand8()
+	}
+
+	err := c.checkFault()
+	if err != nil {
+		c.Registers.R = refresh
+		return err
+	}
+
+	handler := table.handlers[opcode]
+	if handler == nil {
+		c.Registers.R = refresh
+		return c.executionError(ErrNotImplemented)
+	}
+	if c.Strict && table.undocumented[opcode] {
+		c.Registers.R = refresh
+		return c.executionError(ErrUndocumented)
+	}
+
+	pc := c.PC
+	handler(c)
+
+	fault := c.Bus.TakeFault()
+	if fault != nil {
+		c.PC = pc
+		return c.executionError(fault)
 	}
 
-	if !validInstruction {
-		log.Println("unimplemented instruction!")
-		log.Printf("x: %d, y: %d, z: %d, p: %d, q: %d", x, y, z, p, q)
-		return ErrNotImplemented
+	if !c.instruction.jumped {
+		c.PC += c.instruction.length
 	}
+	c.Cycles += uint64(table.cycles[opcode]) + c.instruction.extraCycles + c.Bus.TakeWaitStates()
+	c.observe(pc, c.instruction.length, startCycles)
 
 	return nil
 }
+
+func (c *CPU) observeInterrupt(startCycles uint64) {
+	for _, observer := range c.Observers {
+		observer.Called(c.PC)
+		observer.Executed(c.PC, 0, c.Cycles-startCycles)
+	}
+}
+
+func (c *CPU) observe(pc uint16, length uint16, startCycles uint64) {
+	for _, observer := range c.Observers {
+		observer.Executed(pc, length, c.Cycles-startCycles)
+		if c.instruction.called {
+			observer.Called(c.PC)
+		} else if c.instruction.returned {
+			observer.Returned()
+		}
+	}
+}
+
+func (c *CPU) executionError(err error) *ExecutionError {
+	// peeked, since they were already read once, and reading them again shouldn't count as an access
+	bytes := make([]byte, c.instruction.length)
+	for i := range bytes {
+		bytes[i] = c.Bus.PeekMemoryByte(c.PC + uint16(i))
+	}
+
+	return &ExecutionError{
+		PC:     c.PC,
+		Prefix: c.instruction.prefix,
+		Bytes:  bytes,
+		Err:    err,
+	}
+}
+
+// checkFault turns a failed bus access into an error
+func (c *CPU) checkFault() error {
+	fault := c.Bus.TakeFault()
+	if fault == nil {
+		return nil
+	}
+	return c.executionError(fault)
+}
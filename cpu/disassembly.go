@@ -1,52 +1,360 @@
 package cpu
 
 import (
+	"errors"
 	"strconv"
 	"strings"
+
+	"github.com/thatoddmailbox/computer-emu/symbols"
 )
 
-func DisassembleInstructionAt(sim *CPU, pc uint16) (InstructionInfo, string, uint8) {
-	instruction := sim.Bus.ReadMemoryByte(pc)
-	table := DisassemblyTable_Unprefixed
-	instructionOffset := 0
+var ErrIncompleteInstruction = errors.New("cpu: code ends partway through an instruction")
 
-	if instruction == 0xCB {
-		table = DisassemblyTable_CB
-		instructionOffset = 1
-	} else if instruction == 0xDD {
-		if sim.Bus.ReadMemoryByte(pc + 1) == 0xCB {
-			table = DisassemblyTable_DDCB
-			instructionOffset = 2
-		} else {
-			table = DisassemblyTable_DD
-			instructionOffset = 1
+// OperandType is what an operand's value means.
+type OperandType uint8
+
+const (
+	// a register, condition, bit number, or anything else that's always the same, in Text
+	OperandFixed OperandType = iota
+
+	// an 8 bit number, like in ld a, 0x12
+	OperandImmediate8
+
+	// a 16 bit number, like in ld hl, 0x1234
+	OperandImmediate16
+
+	// an address that's jumped or called to, like in jp 0x1234
+	OperandAddress
+
+	// the memory at an address, like in ld a, [0x1234]
+	OperandIndirect
+
+	// an io port, like in out [0x12], a
+	OperandPort
+
+	// the memory at an index register plus a displacement, like in ld a, [ix+0x12]
+	OperandIndexed
+
+	// where a jr or djnz goes, already worked out from the displacement
+	OperandRelative
+)
+
+type Operand struct {
+	Type OperandType
+
+	// the text of an OperandFixed, or the index register of an OperandIndexed
+	Text string
+
+	// the number, address, or port
+	Value uint16
+
+	// for OperandIndexed
+	Displacement int8
+
+	// for the undocumented ddcb and fdcb instructions that also copy the result to a register, like rlc [ix+0x12]->b
+	CopyTo string
+}
+
+// Instruction is a disassembled instruction.
+type Instruction struct {
+	Address uint16
+
+	// 0 if there isn't one, otherwise 0xCB, 0xED, 0xDD, 0xFD, 0xDDCB, or 0xFDCB, like ExecutionError
+	Prefix uint16
+	Opcode uint8
+
+	// empty if the instruction isn't in the disassembly tables, in which case Bytes is just the prefix and opcode
+	Mnemonic string
+	Operands []Operand
+
+	// every byte of the instruction, including the prefix
+	Bytes []byte
+
+	// whether it's one of the instructions that --strict-cpu stops at
+	Undocumented bool
+
+	info InstructionInfo
+}
+
+// the tables the cpu runs each prefix's instructions from
+func executionTable(prefix uint16) *opcodeTable {
+	switch prefix {
+	case 0xCB:
+		return &opcodeTable_CB
+	case 0xED:
+		return &opcodeTable_ED
+	case 0xDD, 0xFD:
+		return &opcodeTable_DD
+	case 0xDDCB, 0xFDCB:
+		return &opcodeTable_DDCB
+	}
+	return &opcodeTable_Unprefixed
+}
+
+// the disassembly tables by prefix, in the order an assembler would prefer them
+var disassemblyTables = []struct {
+	prefix uint16
+	table  map[uint8]InstructionInfo
+}{
+	{0, DisassemblyTable_Unprefixed},
+	{0xCB, DisassemblyTable_CB},
+	{0xED, DisassemblyTable_ED},
+	{0xDD, DisassemblyTable_DD},
+	{0xFD, DisassemblyTable_FD},
+	{0xDDCB, DisassemblyTable_DDCB},
+	{0xFDCB, DisassemblyTable_FDCB},
+}
+
+// the first prefix and opcode for each mnemonic and parameters in the disassembly tables, which is what an assembler would pick
+var canonicalEncodings = buildCanonicalEncodings()
+
+func buildCanonicalEncodings() map[string]uint32 {
+	encodings := map[string]uint32{}
+	for _, table := range disassemblyTables {
+		for opcode := 0; opcode < 256; opcode++ {
+			info, ok := table.table[uint8(opcode)]
+			if !ok {
+				continue
+			}
+			key := info.Mnemonic + " " + info.Parameters
+			if _, exists := encodings[key]; !exists {
+				encodings[key] = uint32(table.prefix)<<8 | uint32(opcode)
+			}
 		}
-	} else if instruction == 0xED {
+	}
+	return encodings
+}
+
+func formatHex(value uint16) string {
+	return "0x" + strconv.FormatUint(uint64(value), 16)
+}
+
+func decodeInstruction(read func(offset uint16) uint8, address uint16) Instruction {
+	instruction := Instruction{
+		Address: address,
+	}
+
+	table := DisassemblyTable_Unprefixed
+	opcodeOffset := uint16(0)
+	first := read(0)
+	switch first {
+	case 0xCB:
+		table = DisassemblyTable_CB
+		instruction.Prefix = 0xCB
+		opcodeOffset = 1
+	case 0xED:
 		table = DisassemblyTable_ED
-		instructionOffset = 1
-	} else if instruction == 0xFD {
-		if sim.Bus.ReadMemoryByte(pc + 1) == 0xCB {
-			table = DisassemblyTable_FDCB
-			instructionOffset = 2
-		} else {
+		instruction.Prefix = 0xED
+		opcodeOffset = 1
+	case 0xDD, 0xFD:
+		instruction.Prefix = uint16(first)
+		opcodeOffset = 1
+		table = DisassemblyTable_DD
+		if first == 0xFD {
 			table = DisassemblyTable_FD
-			instructionOffset = 1
 		}
+		if read(1) == 0xCB {
+			instruction.Prefix = (instruction.Prefix << 8) | 0xCB
+			// the displacement comes before the opcode
+			opcodeOffset = 3
+			table = DisassemblyTable_DDCB
+			if first == 0xFD {
+				table = DisassemblyTable_FDCB
+			}
+		}
+	}
+
+	instruction.Opcode = read(opcodeOffset)
+	info, known := table[instruction.Opcode]
+	instruction.Undocumented = executionTable(instruction.Prefix).undocumented[instruction.Opcode]
+	length := opcodeOffset + 1
+	if known {
+		instruction.info = info
+		instruction.Mnemonic = info.Mnemonic
+		if opcodeOffset != 3 {
+			// with ddcb and fdcb, the displacement was already counted
+			length += uint16(info.DataBytes)
+		}
+	}
+
+	// the operands are read in order, starting after the opcode, except for the ddcb and fdcb displacement
+	dataOffset := opcodeOffset + 1
+	if opcodeOffset == 3 {
+		dataOffset = 2
+	}
+
+	if info.Parameters != "" {
+		for _, template := range strings.Split(info.Parameters, ", ") {
+			operand := Operand{}
+
+			if strings.Contains(template, "+%d") {
+				operand.Type = OperandIndexed
+				operand.Text = template[strings.Index(template, "[")+1 : strings.Index(template, "+")]
+				operand.Displacement = int8(read(dataOffset))
+				dataOffset += 1
+				if strings.Contains(template, "]->") {
+					operand.CopyTo = template[strings.Index(template, "]->")+3:]
+				}
+			} else if template == "[%d16]" {
+				operand.Type = OperandIndirect
+				operand.Value = registerPair(read(dataOffset+1), read(dataOffset))
+				dataOffset += 2
+			} else if template == "%d16" {
+				operand.Type = OperandImmediate16
+				if info.Mnemonic == "jp" || info.Mnemonic == "call" {
+					operand.Type = OperandAddress
+				}
+				operand.Value = registerPair(read(dataOffset+1), read(dataOffset))
+				dataOffset += 2
+			} else if template == "[%d8]" {
+				operand.Type = OperandPort
+				operand.Value = uint16(read(dataOffset))
+				dataOffset += 1
+			} else if template == "%d8" {
+				operand.Type = OperandImmediate8
+				operand.Value = uint16(read(dataOffset))
+				if info.Mnemonic == "jr" || info.Mnemonic == "djnz" {
+					// relative to the next instruction
+					operand.Type = OperandRelative
+					operand.Value = address + length + uint16(int8(read(dataOffset)))
+				}
+				dataOffset += 1
+			} else {
+				operand.Type = OperandFixed
+				operand.Text = template
+			}
+
+			instruction.Operands = append(instruction.Operands, operand)
+		}
+	}
+
+	instruction.Bytes = make([]byte, length)
+	for i := range instruction.Bytes {
+		instruction.Bytes[i] = read(uint16(i))
+	}
+
+	return instruction
+}
+
+// Disassemble disassembles the instruction at the start of code, which is at address.
+// It returns ErrIncompleteInstruction if code isn't long enough to hold the whole instruction.
+func Disassemble(code []byte, address uint16) (Instruction, error) {
+	incomplete := false
+	instruction := decodeInstruction(func(offset uint16) uint8 {
+		if int(offset) >= len(code) {
+			incomplete = true
+			return 0x00
+		}
+		return code[offset]
+	}, address)
+	if incomplete {
+		return instruction, ErrIncompleteInstruction
+	}
+	return instruction, nil
+}
+
+// DisassembleAt disassembles the instruction at pc, peeking at it through the cpu's bus.
+// It doesn't run the bus's hooks or count wait states, so looking at an instruction doesn't change anything.
+func DisassembleAt(sim *CPU, pc uint16) Instruction {
+	return decodeInstruction(func(offset uint16) uint8 {
+		return sim.Bus.PeekMemoryByte(pc + offset)
+	}, pc)
+}
+
+// DisassembleInstructionAt disassembles the instruction at pc, returning its entry in the disassembly tables,
+// its operands formatted with the cpu's symbols, and its length.
+func DisassembleInstructionAt(sim *CPU, pc uint16) (InstructionInfo, string, uint8) {
+	instruction := DisassembleAt(sim, pc)
+	return instruction.info, instruction.FormatOperands(sim.Symbols), uint8(len(instruction.Bytes))
+}
+
+// Length returns the number of bytes in the instruction, including the prefix.
+func (i Instruction) Length() uint16 {
+	return uint16(len(i.Bytes))
+}
+
+// Known returns whether the instruction is in the disassembly tables.
+func (i Instruction) Known() bool {
+	return i.Mnemonic != ""
+}
+
+// Target returns where a jump, call, or rst goes, if that's known without running it.
+func (i Instruction) Target() (uint16, bool) {
+	if i.Mnemonic == "rst" && len(i.Operands) == 1 {
+		target, err := strconv.ParseUint(strings.TrimPrefix(i.Operands[0].Text, "0x"), 16, 16)
+		return uint16(target), err == nil
+	}
+	for _, operand := range i.Operands {
+		if operand.Type == OperandAddress || operand.Type == OperandRelative {
+			return operand.Value, true
+		}
+	}
+	return 0, false
+}
+
+// Canonical returns whether assembling the instruction gives back the same bytes.
+// That isn't true for the duplicate encodings, like ld hl, [nn] with an ed prefix, since an assembler picks the shorter one.
+func (i Instruction) Canonical() bool {
+	if !i.Known() {
+		return false
+	}
+	return canonicalEncodings[i.info.Mnemonic+" "+i.info.Parameters] == uint32(i.Prefix)<<8|uint32(i.Opcode)
+}
+
+// Conditional returns whether the instruction only jumps, calls, or returns when a condition is met.
+func (i Instruction) Conditional() bool {
+	switch i.Mnemonic {
+	case "jp", "call", "jr":
+		return len(i.Operands) == 2
+	case "ret":
+		return len(i.Operands) == 1
+	case "djnz":
+		return true
+	}
+	return false
+}
+
+// Format returns the operand, with addresses shown as labels from s, which can be nil.
+func (o Operand) Format(s *symbols.Symbols) string {
+	switch o.Type {
+	case OperandImmediate8, OperandImmediate16:
+		return formatHex(o.Value)
+	case OperandAddress, OperandRelative:
+		return s.Format(o.Value)
+	case OperandIndirect:
+		return "[" + s.Format(o.Value) + "]"
+	case OperandPort:
+		return "[" + formatHex(o.Value) + "]"
+	case OperandIndexed:
+		text := "[" + o.Text + "+" + formatHex(uint16(o.Displacement)) + "]"
+		if o.Displacement < 0 {
+			text = "[" + o.Text + "-" + formatHex(uint16(-int16(o.Displacement))) + "]"
+		}
+		if o.CopyTo != "" {
+			text += "->" + o.CopyTo
+		}
+		return text
 	}
+	return o.Text
+}
 
-	if instructionOffset > 0 {
-		instruction = sim.Bus.ReadMemoryByte(pc + uint16(instructionOffset))
+// FormatOperands returns the operands separated by commas, with addresses shown as labels from s, which can be nil.
+func (i Instruction) FormatOperands(s *symbols.Symbols) string {
+	operands := []string{}
+	for _, operand := range i.Operands {
+		operands = append(operands, operand.Format(s))
 	}
+	return strings.Join(operands, ", ")
+}
 
-	info := table[instruction]
-	formattedParams := info.Parameters
-	if info.DataBytes == 1 {
-		data := uint64(sim.Bus.ReadMemoryByte(pc + 1))
-		formattedParams = strings.Replace(formattedParams, "%d8", "0x" + strconv.FormatUint(data, 16), -1)
-	} else if info.DataBytes == 2 {
-		data := uint64((uint16(sim.Bus.ReadMemoryByte(pc + 2)) << 8) | uint16(sim.Bus.ReadMemoryByte(pc + 1)))
-		formattedParams = strings.Replace(formattedParams, "%d16", "0x" + strconv.FormatUint(data, 16), -1)
+// Format returns the instruction as assembly, with addresses shown as labels from s, which can be nil.
+func (i Instruction) Format(s *symbols.Symbols) string {
+	if len(i.Operands) == 0 {
+		return i.Mnemonic
 	}
+	return i.Mnemonic + " " + i.FormatOperands(s)
+}
 
-	return info, formattedParams, (uint8(instructionOffset) + 1 + info.DataBytes)
-}
\ No newline at end of file
+func (i Instruction) String() string {
+	return i.Format(nil)
+}
@@ -23,7 +23,7 @@ var DisassemblyTable_Unprefixed = map[uint8]InstructionInfo {
 	0x0D: InstructionInfo{"dec", "c", 0},
 	0x0E: InstructionInfo{"ld", "c, %d8", 1},
 	0x0F: InstructionInfo{"rrca", "", 0},
-	0x10: InstructionInfo{"djnz", "%d16", 2},
+	0x10: InstructionInfo{"djnz", "%d8", 1},
 	0x11: InstructionInfo{"ld", "de, %d16", 2},
 	0x12: InstructionInfo{"ld", "[de], a", 0},
 	0x13: InstructionInfo{"inc", "de", 0},
@@ -31,7 +31,7 @@ var DisassemblyTable_Unprefixed = map[uint8]InstructionInfo {
 	0x15: InstructionInfo{"dec", "d", 0},
 	0x16: InstructionInfo{"ld", "d, %d8", 1},
 	0x17: InstructionInfo{"rla", "", 0},
-	0x18: InstructionInfo{"jr", "%d16", 2},
+	0x18: InstructionInfo{"jr", "%d8", 1},
 	0x19: InstructionInfo{"add", "hl, de", 0},
 	0x1A: InstructionInfo{"ld", "a, [de]", 0},
 	0x1B: InstructionInfo{"dec", "de", 0},
@@ -39,15 +39,15 @@ var DisassemblyTable_Unprefixed = map[uint8]InstructionInfo {
 	0x1D: InstructionInfo{"dec", "e", 0},
 	0x1E: InstructionInfo{"ld", "e, %d8", 1},
 	0x1F: InstructionInfo{"rra", "", 0},
-	0x20: InstructionInfo{"jr", "nz, %d16", 2},
+	0x20: InstructionInfo{"jr", "nz, %d8", 1},
 	0x21: InstructionInfo{"ld", "hl, %d16", 2},
-	0x22: InstructionInfo{"ld", "[%d16], h", 2},
+	0x22: InstructionInfo{"ld", "[%d16], hl", 2},
 	0x23: InstructionInfo{"inc", "hl", 0},
 	0x24: InstructionInfo{"inc", "h", 0},
 	0x25: InstructionInfo{"dec", "h", 0},
 	0x26: InstructionInfo{"ld", "h, %d8", 1},
 	0x27: InstructionInfo{"daa", "", 0},
-	0x28: InstructionInfo{"jr", "z, %d16", 2},
+	0x28: InstructionInfo{"jr", "z, %d8", 1},
 	0x29: InstructionInfo{"add", "hl, hl", 0},
 	0x2A: InstructionInfo{"ld", "hl, [%d16]", 2},
 	0x2B: InstructionInfo{"dec", "hl", 0},
@@ -55,7 +55,7 @@ var DisassemblyTable_Unprefixed = map[uint8]InstructionInfo {
 	0x2D: InstructionInfo{"dec", "l", 0},
 	0x2E: InstructionInfo{"ld", "l, %d8", 1},
 	0x2F: InstructionInfo{"cpl", "", 0},
-	0x30: InstructionInfo{"jr", "nc, %d16", 2},
+	0x30: InstructionInfo{"jr", "nc, %d8", 1},
 	0x31: InstructionInfo{"ld", "sp, %d16", 2},
 	0x32: InstructionInfo{"ld", "[%d16], a", 2},
 	0x33: InstructionInfo{"inc", "sp", 0},
@@ -63,7 +63,7 @@ var DisassemblyTable_Unprefixed = map[uint8]InstructionInfo {
 	0x35: InstructionInfo{"dec", "[hl]", 0},
 	0x36: InstructionInfo{"ld", "[hl], %d8", 1},
 	0x37: InstructionInfo{"scf", "", 0},
-	0x38: InstructionInfo{"jr", "c, %d16", 2},
+	0x38: InstructionInfo{"jr", "c, %d8", 1},
 	0x39: InstructionInfo{"add", "hl, sp", 0},
 	0x3A: InstructionInfo{"ld", "a, [%d16]", 2},
 	0x3B: InstructionInfo{"dec", "sp", 0},
@@ -206,7 +206,7 @@ var DisassemblyTable_Unprefixed = map[uint8]InstructionInfo {
 	0xC4: InstructionInfo{"call", "nz, %d16", 2},
 	0xC5: InstructionInfo{"push", "bc", 0},
 	0xC6: InstructionInfo{"add", "a, %d8", 1},
-	0xC7: InstructionInfo{"rst", "%d8", 1},
+	0xC7: InstructionInfo{"rst", "0x00", 0},
 	0xC8: InstructionInfo{"ret", "z", 0},
 	0xC9: InstructionInfo{"ret", "", 0},
 	0xCA: InstructionInfo{"jp", "z, %d16", 2},
@@ -314,14 +314,14 @@ var DisassemblyTable_CB = map[uint8]InstructionInfo {
 	0x2D: InstructionInfo{"sra", "l", 0},
 	0x2E: InstructionInfo{"sra", "[hl]", 0},
 	0x2F: InstructionInfo{"sra", "a", 0},
-	0x30: InstructionInfo{"sls", "b", 0},
-	0x31: InstructionInfo{"sls", "c", 0},
-	0x32: InstructionInfo{"sls", "d", 0},
-	0x33: InstructionInfo{"sls", "e", 0},
-	0x34: InstructionInfo{"sls", "h", 0},
-	0x35: InstructionInfo{"sls", "l", 0},
-	0x36: InstructionInfo{"sls", "[hl]", 0},
-	0x37: InstructionInfo{"sls", "a", 0},
+	0x30: InstructionInfo{"sll", "b", 0},
+	0x31: InstructionInfo{"sll", "c", 0},
+	0x32: InstructionInfo{"sll", "d", 0},
+	0x33: InstructionInfo{"sll", "e", 0},
+	0x34: InstructionInfo{"sll", "h", 0},
+	0x35: InstructionInfo{"sll", "l", 0},
+	0x36: InstructionInfo{"sll", "[hl]", 0},
+	0x37: InstructionInfo{"sll", "a", 0},
 	0x38: InstructionInfo{"srl", "b", 0},
 	0x39: InstructionInfo{"srl", "c", 0},
 	0x3A: InstructionInfo{"srl", "d", 0},
@@ -811,14 +811,14 @@ var DisassemblyTable_DDCB = map[uint8]InstructionInfo{
 	0x2D: InstructionInfo{"sra", "[ix+%ds8]->l", 1},
 	0x2E: InstructionInfo{"sra", "[ix+%ds8]", 1},
 	0x2F: InstructionInfo{"sra", "[ix+%ds8]->a", 1},
-	0x30: InstructionInfo{"sls", "[ix+%ds8]->b", 1},
-	0x31: InstructionInfo{"sls", "[ix+%ds8]->c", 1},
-	0x32: InstructionInfo{"sls", "[ix+%ds8]->d", 1},
-	0x33: InstructionInfo{"sls", "[ix+%ds8]->e", 1},
-	0x34: InstructionInfo{"sls", "[ix+%ds8]->h", 1},
-	0x35: InstructionInfo{"sls", "[ix+%ds8]->l", 1},
-	0x36: InstructionInfo{"sls", "[ix+%ds8]", 1},
-	0x37: InstructionInfo{"sls", "[ix+%ds8]->a", 1},
+	0x30: InstructionInfo{"sll", "[ix+%ds8]->b", 1},
+	0x31: InstructionInfo{"sll", "[ix+%ds8]->c", 1},
+	0x32: InstructionInfo{"sll", "[ix+%ds8]->d", 1},
+	0x33: InstructionInfo{"sll", "[ix+%ds8]->e", 1},
+	0x34: InstructionInfo{"sll", "[ix+%ds8]->h", 1},
+	0x35: InstructionInfo{"sll", "[ix+%ds8]->l", 1},
+	0x36: InstructionInfo{"sll", "[ix+%ds8]", 1},
+	0x37: InstructionInfo{"sll", "[ix+%ds8]->a", 1},
 	0x38: InstructionInfo{"srl", "[ix+%ds8]->b", 1},
 	0x39: InstructionInfo{"srl", "[ix+%ds8]->c", 1},
 	0x3A: InstructionInfo{"srl", "[ix+%ds8]->d", 1},
@@ -1070,14 +1070,14 @@ var DisassemblyTable_FDCB = map[uint8]InstructionInfo{
 	0x2D: InstructionInfo{"sra", "[iy+%ds8]->l", 1},
 	0x2E: InstructionInfo{"sra", "[iy+%ds8]", 1},
 	0x2F: InstructionInfo{"sra", "[iy+%ds8]->a", 1},
-	0x30: InstructionInfo{"sls", "[iy+%ds8]->b", 1},
-	0x31: InstructionInfo{"sls", "[iy+%ds8]->c", 1},
-	0x32: InstructionInfo{"sls", "[iy+%ds8]->d", 1},
-	0x33: InstructionInfo{"sls", "[iy+%ds8]->e", 1},
-	0x34: InstructionInfo{"sls", "[iy+%ds8]->h", 1},
-	0x35: InstructionInfo{"sls", "[iy+%ds8]->l", 1},
-	0x36: InstructionInfo{"sls", "[iy+%ds8]", 1},
-	0x37: InstructionInfo{"sls", "[iy+%ds8]->a", 1},
+	0x30: InstructionInfo{"sll", "[iy+%ds8]->b", 1},
+	0x31: InstructionInfo{"sll", "[iy+%ds8]->c", 1},
+	0x32: InstructionInfo{"sll", "[iy+%ds8]->d", 1},
+	0x33: InstructionInfo{"sll", "[iy+%ds8]->e", 1},
+	0x34: InstructionInfo{"sll", "[iy+%ds8]->h", 1},
+	0x35: InstructionInfo{"sll", "[iy+%ds8]->l", 1},
+	0x36: InstructionInfo{"sll", "[iy+%ds8]", 1},
+	0x37: InstructionInfo{"sll", "[iy+%ds8]->a", 1},
 	0x38: InstructionInfo{"srl", "[iy+%ds8]->b", 1},
 	0x39: InstructionInfo{"srl", "[iy+%ds8]->c", 1},
 	0x3A: InstructionInfo{"srl", "[iy+%ds8]->d", 1},
@@ -0,0 +1,138 @@
+package cpu
+
+// an opcodeHandler executes one instruction. operands are read with the fetch functions, which keep track of the instruction's length.
+type opcodeHandler func(c *CPU)
+
+// state of the instruction that's currently executing
+type instructionState struct {
+	// bytes read so far, including prefixes and the opcode
+	length uint16
+
+	// the handler set pc itself, so it shouldn't be advanced past the instruction
+	jumped bool
+
+	// t-states on top of what the cycle table says, for taken branches and repeats
+	extraCycles uint64
+
+	// 0 if there wasn't one, otherwise 0xCB, 0xED, 0xDD, 0xFD, 0xDDCB, or 0xFDCB
+	prefix uint16
+
+	// ix or iy, for the dd/fd and ddcb/fdcb prefixes
+	indexRegister RegisterPairType
+
+	// a call or rst was taken, for the ExecutionObserver
+	called bool
+
+	// a ret was taken
+	returned bool
+
+	breakpointTrigger func()
+}
+
+type opcodeTable struct {
+	// nil entries aren't valid instructions
+	handlers [256]opcodeHandler
+
+	cycles *[256]uint8
+
+	// instructions that aren't in the datasheet, which strict mode refuses to run
+	undocumented [256]bool
+}
+
+var opcodeTable_Unprefixed = opcodeTable{cycles: &CycleTable_Unprefixed}
+var opcodeTable_CB = opcodeTable{cycles: &CycleTable_CB}
+var opcodeTable_ED = opcodeTable{cycles: &CycleTable_ED}
+var opcodeTable_DD = opcodeTable{cycles: &CycleTable_DD}     // also used for fd
+var opcodeTable_DDCB = opcodeTable{cycles: &CycleTable_DDCB} // also used for fdcb
+var opcodeTable_8080 = opcodeTable{cycles: &CycleTable_8080}
+
+// a dd or fd that's followed by another prefix, which the cpu ignores
+// (the dd table has the 4 t-states that takes)
+var opcodeTable_IgnoredPrefix = opcodeTable{cycles: &CycleTable_DD}
+
+func init() {
+	for i := 0; i < 256; i++ {
+		x, y, z, p, q := decodeOpcode(uint8(i))
+
+		opcodeTable_Unprefixed.handlers[i] = unprefixedHandler(x, y, z, p, q)
+
+		opcodeTable_CB.handlers[i] = cbHandler(x, y, z)
+		opcodeTable_CB.undocumented[i] = (x == 0 && y == 6) // sll
+
+		opcodeTable_ED.handlers[i] = edHandler(x, y, z, p, q)
+		opcodeTable_ED.undocumented[i] = undocumentedED(x, y, z, p, q)
+
+		opcodeTable_DD.handlers[i] = indexHandler(x, y, z, p, q)
+		opcodeTable_DD.undocumented[i] = (documentedIndexHandler(x, y, z, p, q) == nil)
+
+		opcodeTable_DDCB.handlers[i] = indexBitHandler(x, y, z)
+		opcodeTable_DDCB.undocumented[i] = (z != 6) // the result is copied to r[z]
+
+		opcodeTable_8080.handlers[i] = i8080Handler(x, y, z, p, q)
+		opcodeTable_8080.undocumented[i] = undocumented8080(x, y, z, p, q)
+	}
+
+	for _, prefix := range []uint8{0xDD, 0xFD} {
+		opcodeTable_IgnoredPrefix.handlers[prefix] = func(c *CPU) {}
+		opcodeTable_IgnoredPrefix.undocumented[prefix] = true
+	}
+}
+
+func decodeOpcode(opcode uint8) (x uint8, y uint8, z uint8, p uint8, q uint8) {
+	x = (opcode & 0xC0) >> 6 // 0b11000000
+	y = (opcode & 0x38) >> 3 // 0b00111000
+	z = (opcode & 0x07)      // 0b00000111
+	p = y >> 1
+	q = y % 2
+	return
+}
+
+func (c *CPU) fetchOperand8() uint8 {
+	value := c.Bus.ReadMemoryByte(c.PC + c.instruction.length)
+	c.instruction.length += 1
+	return value
+}
+
+func (c *CPU) fetchOperand16() uint16 {
+	low := c.fetchOperand8()
+	high := c.fetchOperand8()
+	return registerPair(high, low)
+}
+
+// target of jr/djnz, relative to the end of the instruction
+func (c *CPU) fetchRelativeTarget() uint16 {
+	displacement := int8(c.fetchOperand8())
+	return c.PC + c.instruction.length + uint16(displacement)
+}
+
+// address for [ix+d]/[iy+d], with the displacement following the opcode
+func (c *CPU) fetchIndexedAddress() uint16 {
+	return c.indexedAddress(c.fetchOperand8())
+}
+
+func (c *CPU) indexedAddress(displacement uint8) uint16 {
+	c.WZ = c.Get16bitRegister(c.instruction.indexRegister) + uint16(int8(displacement))
+	return c.WZ
+}
+
+func (c *CPU) jump(address uint16) {
+	c.PC = address
+	c.instruction.jumped = true
+}
+
+// address of the instruction after this one, for calls
+func (c *CPU) nextInstruction() uint16 {
+	return c.PC + c.instruction.length
+}
+
+func (c *CPU) call(address uint16) {
+	c.pushWord(c.nextInstruction())
+	c.jump(address)
+	c.instruction.called = true
+}
+
+func (c *CPU) ret() {
+	c.WZ = c.popWord()
+	c.jump(c.WZ)
+	c.instruction.returned = true
+}
@@ -0,0 +1,128 @@
+package cpu
+
+// the 8080 shares the z80's unprefixed opcodes, except for the ones that change flags and the ones the z80 added
+func i8080Handler(x, y, z, p, q uint8) opcodeHandler {
+	switch x {
+	case 0:
+		switch z {
+		case 0:
+			// nop, and its undocumented aliases where the z80 has ex af, af', djnz, and jr
+			return func(c *CPU) {}
+		case 1:
+			if q == 1 {
+				// dad rp[p], which only changes the carry flag
+				pair := DecodeTable_RP[p]
+				return func(c *CPU) {
+					hl := c.Get16bitRegister(RegisterPairHL)
+					result := uint32(hl) + uint32(c.Get16bitRegister(pair))
+					c.Set16bitRegister(RegisterPairHL, uint16(result))
+					c.setFlag(FlagCarry, result > 0xFFFF)
+				}
+			}
+		case 4:
+			// inr r[y]
+			register := DecodeTable_R[y]
+			return func(c *CPU) {
+				c.Set8bitRegister(register, c.increment8080(c.Get8bitRegister(register)))
+			}
+		case 5:
+			// dcr r[y]
+			register := DecodeTable_R[y]
+			return func(c *CPU) {
+				c.Set8bitRegister(register, c.decrement8080(c.Get8bitRegister(register)))
+			}
+		case 7:
+			switch y {
+			case 0, 1, 2, 3:
+				// rlc, rrc, ral, rar
+				operation := DecodeTable_ROT[y]
+				return func(c *CPU) {
+					c.rotateAccumulator8080(operation)
+				}
+			case 4:
+				// daa
+				return func(c *CPU) {
+					c.decimalAdjust8080()
+				}
+			case 5:
+				// cma, which doesn't change any flags
+				return func(c *CPU) {
+					c.Registers.A = ^c.Registers.A
+				}
+			case 6:
+				// stc
+				return func(c *CPU) {
+					c.setFlag(FlagCarry, true)
+				}
+			case 7:
+				// cmc
+				return func(c *CPU) {
+					c.setFlag(FlagCarry, !c.getFlag(FlagCarry))
+				}
+			}
+		}
+	case 2:
+		// alu[y] r[z]
+		operation := DecodeTable_ALU[y]
+		operand := DecodeTable_R[z]
+		return func(c *CPU) {
+			c.doALUOperation8080(operation, c.Get8bitRegister(operand))
+		}
+	case 3:
+		switch z {
+		case 1:
+			if q == 0 && p == 3 {
+				// pop psw
+				return func(c *CPU) {
+					value := c.popWord()
+					c.Registers.A = uint8(value >> 8)
+					c.Registers.Flag = (uint8(value) & flagMask8080) | flagAlwaysSet8080
+				}
+			} else if q == 1 && p == 1 {
+				// undocumented alias of ret, where the z80 has exx
+				return unprefixedHandler(3, 1, 1, 0, 1)
+			}
+		case 3:
+			if y == 1 {
+				// undocumented alias of jmp, where the z80 has the cb prefix
+				return unprefixedHandler(3, 0, 3, 0, 0)
+			}
+		case 4:
+			// ccc nn, which takes one less t-state than the z80's call cc when taken
+			condition := DecodeTable_CC[y]
+			return func(c *CPU) {
+				c.WZ = c.fetchOperand16()
+				if c.ConditionMet(condition) {
+					c.call(c.WZ)
+					c.instruction.extraCycles += CycleExtraCall8080
+				}
+			}
+		case 5:
+			if q == 1 && p != 0 {
+				// undocumented aliases of call, where the z80 has the dd, ed, and fd prefixes
+				return unprefixedHandler(3, 1, 5, 0, 1)
+			}
+		case 6:
+			// alu[y] n
+			operation := DecodeTable_ALU[y]
+			return func(c *CPU) {
+				c.doALUOperation8080(operation, c.fetchOperand8())
+			}
+		}
+	}
+	return unprefixedHandler(x, y, z, p, q)
+}
+
+// the nop, jmp, call, and ret aliases
+func undocumented8080(x, y, z, p, q uint8) bool {
+	if x == 0 && z == 0 {
+		return y != 0
+	} else if x == 3 && z == 3 {
+		return y == 1
+	} else if x == 3 && z == 1 {
+		return q == 1 && p == 1
+	} else if x == 3 && z == 5 {
+		return q == 1 && p != 0
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package cpu
+
+func cbHandler(x, y, z uint8) opcodeHandler {
+	operand := DecodeTable_R[z]
+	switch x {
+	case 0:
+		// rot[y] r[z]
+		operation := DecodeTable_ROT[y]
+		return func(c *CPU) {
+			c.Set8bitRegister(operand, c.DoALUShiftOperation(operation, c.Get8bitRegister(operand)))
+		}
+	case 1:
+		// bit y, r[z]
+		if operand == RegisterIndirectHL {
+			return func(c *CPU) {
+				c.DoBitTest(y, c.Get8bitRegister(operand), uint8(c.WZ>>8))
+			}
+		}
+		return func(c *CPU) {
+			value := c.Get8bitRegister(operand)
+			c.DoBitTest(y, value, value)
+		}
+	case 2:
+		// res y, r[z]
+		mask := ^uint8(1 << y)
+		return func(c *CPU) {
+			c.Set8bitRegister(operand, c.Get8bitRegister(operand)&mask)
+		}
+	default:
+		// set y, r[z]
+		mask := uint8(1 << y)
+		return func(c *CPU) {
+			c.Set8bitRegister(operand, c.Get8bitRegister(operand)|mask)
+		}
+	}
+}
+
+// ddcb and fdcb, where the displacement comes before the opcode
+func indexBitHandler(x, y, z uint8) opcodeHandler {
+	var operation func(c *CPU, value uint8) uint8
+	switch x {
+	case 0:
+		// rot[y] [ix+d]
+		shiftOperation := DecodeTable_ROT[y]
+		operation = func(c *CPU, value uint8) uint8 {
+			return c.DoALUShiftOperation(shiftOperation, value)
+		}
+	case 1:
+		// bit y, [ix+d]
+		return func(c *CPU) {
+			address := c.indexedAddress(c.Bus.ReadMemoryByte(c.PC + 2))
+			c.DoBitTest(y, c.Bus.ReadMemoryByte(address), uint8(c.WZ>>8))
+		}
+	case 2:
+		// res y, [ix+d]
+		mask := ^uint8(1 << y)
+		operation = func(c *CPU, value uint8) uint8 {
+			return value & mask
+		}
+	default:
+		// set y, [ix+d]
+		mask := uint8(1 << y)
+		operation = func(c *CPU, value uint8) uint8 {
+			return value | mask
+		}
+	}
+
+	return func(c *CPU) {
+		address := c.indexedAddress(c.Bus.ReadMemoryByte(c.PC + 2))
+		result := operation(c, c.Bus.ReadMemoryByte(address))
+		c.Bus.WriteMemoryByte(address, result)
+		if z != 6 {
+			// undocumented: the result is also copied to r[z]
+			c.Set8bitRegister(DecodeTable_R[z], result)
+		}
+	}
+}
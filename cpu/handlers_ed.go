@@ -0,0 +1,273 @@
+package cpu
+
+func edHandler(x, y, z, p, q uint8) opcodeHandler {
+	if x == 2 && y > 3 && z < 4 {
+		return blockHandler(y, z)
+	}
+	if x != 1 {
+		// undocumented: the rest act as two nops
+		return func(c *CPU) {}
+	}
+
+	switch z {
+	case 0:
+		// in r[y], [c]
+		register := DecodeTable_R[y]
+		return func(c *CPU) {
+			value := c.Bus.ReadIOByte(c.Registers.C)
+			if register != RegisterIndirectHL {
+				c.Set8bitRegister(register, value)
+			}
+			c.setSZPFlags(value)
+			c.setFlag(FlagHalfCarry, false)
+			c.setFlag(FlagSubtract, false)
+			c.setXYFlags(value)
+			c.WZ = registerPair(c.Registers.B, c.Registers.C) + 1
+		}
+	case 1:
+		// out [c], r[y]
+		register := DecodeTable_R[y]
+		return func(c *CPU) {
+			value := uint8(0)
+			if register != RegisterIndirectHL {
+				value = c.Get8bitRegister(register)
+			}
+			c.Bus.WriteIOByte(c.Registers.C, value)
+			c.WZ = registerPair(c.Registers.B, c.Registers.C) + 1
+		}
+	case 2:
+		pair := DecodeTable_RP[p]
+		if q == 0 {
+			// sbc hl, rp[p]
+			return func(c *CPU) {
+				orig := c.Get16bitRegister(RegisterPairHL)
+				c.Set16bitRegister(RegisterPairHL, c.SubtractWithCarry16WithFlags(orig, c.Get16bitRegister(pair)))
+				c.WZ = orig + 1
+			}
+		}
+		// adc hl, rp[p]
+		return func(c *CPU) {
+			orig := c.Get16bitRegister(RegisterPairHL)
+			c.Set16bitRegister(RegisterPairHL, c.AddWithCarry16WithFlags(orig, c.Get16bitRegister(pair)))
+			c.WZ = orig + 1
+		}
+	case 3:
+		pair := DecodeTable_RP[p]
+		if q == 0 {
+			// ld [nn], rp[p]
+			return func(c *CPU) {
+				address := c.fetchOperand16()
+				value := c.Get16bitRegister(pair)
+				c.Bus.WriteMemoryByte(address, uint8(value&0xFF))
+				c.Bus.WriteMemoryByte(address+1, uint8((value&0xFF00)>>8))
+				c.WZ = address + 1
+			}
+		}
+		// ld rp[p], [nn]
+		return func(c *CPU) {
+			address := c.fetchOperand16()
+			c.Set16bitRegister(pair, registerPair(c.Bus.ReadMemoryByte(address+1), c.Bus.ReadMemoryByte(address)))
+			c.WZ = address + 1
+		}
+	case 4:
+		// neg
+		return func(c *CPU) {
+			c.Registers.A = c.Subtract8WithFlags(0, c.Registers.A)
+		}
+	case 5:
+		// retn, reti
+		return func(c *CPU) {
+			c.ret()
+			c.IFF1 = c.IFF2
+		}
+	case 6:
+		// im im[y]
+		mode := DecodeTable_IM[y]
+		return func(c *CPU) {
+			c.InterruptMode = mode
+		}
+	default:
+		return edMiscHandler(y)
+	}
+}
+
+// which of the ed instructions aren't in the datasheet, including the duplicates of neg, retn, and im
+func undocumentedED(x, y, z, p, q uint8) bool {
+	if x == 2 {
+		return !(y > 3 && z < 4)
+	} else if x != 1 {
+		return true
+	}
+
+	switch z {
+	case 0, 1:
+		// in [c], out [c], 0
+		return y == 6
+	case 4:
+		return y != 0
+	case 5:
+		// retn is y = 0, reti is y = 1
+		return y > 1
+	case 6:
+		return y != 0 && y != 2 && y != 3
+	case 7:
+		return y > 5
+	}
+	return false
+}
+
+// x = 1, z = 7
+func edMiscHandler(y uint8) opcodeHandler {
+	switch y {
+	case 0:
+		// ld i, a
+		return func(c *CPU) {
+			c.Registers.I = c.Registers.A
+		}
+	case 1:
+		// ld r, a
+		return func(c *CPU) {
+			c.Registers.R = c.Registers.A
+		}
+	case 2, 3:
+		// ld a, i
+		// ld a, r
+		return func(c *CPU) {
+			if y == 2 {
+				c.Registers.A = c.Registers.I
+			} else {
+				c.Registers.A = c.Registers.R
+			}
+			c.setFlag(FlagSign, (c.Registers.A&(1<<7) != 0))
+			c.setFlag(FlagZero, (c.Registers.A == 0))
+			c.setFlag(FlagHalfCarry, false)
+			c.setFlag(FlagParityOverflow, c.IFF2)
+			c.setFlag(FlagSubtract, false)
+			c.setXYFlags(c.Registers.A)
+		}
+	case 4:
+		// rrd
+		return func(c *CPU) {
+			address := registerPair(c.Registers.H, c.Registers.L)
+			value := c.Bus.ReadMemoryByte(address)
+			c.Bus.WriteMemoryByte(address, (c.Registers.A<<4)|(value>>4))
+			c.Registers.A = (c.Registers.A & 0xF0) | (value & 0x0F)
+			c.setSZPFlags(c.Registers.A)
+			c.setFlag(FlagHalfCarry, false)
+			c.setFlag(FlagSubtract, false)
+			c.setXYFlags(c.Registers.A)
+			c.WZ = address + 1
+		}
+	case 5:
+		// rld
+		return func(c *CPU) {
+			address := registerPair(c.Registers.H, c.Registers.L)
+			value := c.Bus.ReadMemoryByte(address)
+			c.Bus.WriteMemoryByte(address, (value<<4)|(c.Registers.A&0x0F))
+			c.Registers.A = (c.Registers.A & 0xF0) | (value >> 4)
+			c.setSZPFlags(c.Registers.A)
+			c.setFlag(FlagHalfCarry, false)
+			c.setFlag(FlagSubtract, false)
+			c.setXYFlags(c.Registers.A)
+			c.WZ = address + 1
+		}
+	default:
+		// nop
+		return func(c *CPU) {}
+	}
+}
+
+// bli[y,z]
+// the repeating versions do one iteration at a time, running the same instruction again until they're done
+func blockHandler(y, z uint8) opcodeHandler {
+	step := uint16(1)
+	if y == 5 || y == 7 {
+		step = 0xFFFF
+	}
+	repeat := (y >= 6)
+
+	var iteration func(c *CPU) bool
+	switch z {
+	case 0:
+		// ld
+		iteration = func(c *CPU) bool {
+			address := c.Get16bitRegister(RegisterPairHL)
+			toAddress := c.Get16bitRegister(RegisterPairDE)
+			counter := c.Get16bitRegister(RegisterPairBC) - 1
+
+			dataByte := c.Bus.ReadMemoryByte(address)
+			c.Bus.WriteMemoryByte(toAddress, dataByte)
+
+			c.setBlockTransferFlags(dataByte, counter)
+
+			c.Set16bitRegister(RegisterPairHL, address+step)
+			c.Set16bitRegister(RegisterPairDE, toAddress+step)
+			c.Set16bitRegister(RegisterPairBC, counter)
+
+			return (counter == 0)
+		}
+	case 1:
+		// cp
+		iteration = func(c *CPU) bool {
+			address := c.Get16bitRegister(RegisterPairHL)
+			counter := c.Get16bitRegister(RegisterPairBC) - 1
+
+			c.setBlockCompareFlags(c.Bus.ReadMemoryByte(address), counter)
+
+			c.Set16bitRegister(RegisterPairHL, address+step)
+			c.Set16bitRegister(RegisterPairBC, counter)
+
+			done := (counter == 0 || c.getFlag(FlagZero))
+			if !repeat || done {
+				c.WZ = c.WZ + step
+			}
+			return done
+		}
+	case 2:
+		// in
+		iteration = func(c *CPU) bool {
+			address := c.Get16bitRegister(RegisterPairHL)
+			dataByte := c.Bus.ReadIOByte(c.Registers.C)
+			c.WZ = registerPair(c.Registers.B, c.Registers.C) + step
+			c.Bus.WriteMemoryByte(address, dataByte)
+
+			c.Registers.B = c.Registers.B - 1
+			c.Set16bitRegister(RegisterPairHL, address+step)
+
+			c.setBlockIOFlags(dataByte, uint16(dataByte)+uint16(c.Registers.C+uint8(step)))
+
+			return (c.Registers.B == 0)
+		}
+	default:
+		// out
+		iteration = func(c *CPU) bool {
+			address := c.Get16bitRegister(RegisterPairHL)
+			dataByte := c.Bus.ReadMemoryByte(address)
+			c.Registers.B = c.Registers.B - 1
+			c.Bus.WriteIOByte(c.Registers.C, dataByte)
+			c.WZ = registerPair(c.Registers.B, c.Registers.C) + step
+
+			c.Set16bitRegister(RegisterPairHL, address+step)
+
+			c.setBlockIOFlags(dataByte, uint16(dataByte)+uint16(c.Registers.L))
+
+			return (c.Registers.B == 0)
+		}
+	}
+
+	if !repeat {
+		return func(c *CPU) {
+			iteration(c)
+		}
+	}
+	return func(c *CPU) {
+		if !iteration(c) {
+			// run the same instruction again
+			c.jump(c.PC)
+			c.instruction.extraCycles += CycleExtraRepeat
+			if z < 2 {
+				c.WZ = c.PC + 1
+			}
+		}
+	}
+}
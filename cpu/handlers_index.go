@@ -0,0 +1,201 @@
+package cpu
+
+// dd and fd, which replace hl with ix or iy. the index register comes from the prefix.
+func indexHandler(x, y, z, p, q uint8) opcodeHandler {
+	handler := documentedIndexHandler(x, y, z, p, q)
+	if handler != nil {
+		return handler
+	}
+	return undocumentedIndexHandler(x, y, z, p, q)
+}
+
+func documentedIndexHandler(x, y, z, p, q uint8) opcodeHandler {
+	switch x {
+	case 0:
+		if z == 1 {
+			if q == 0 && p == 2 {
+				// ld ix, nn
+				return func(c *CPU) {
+					c.Set16bitRegister(c.instruction.indexRegister, c.fetchOperand16())
+				}
+			} else if q == 1 {
+				// add ix, rp[p]
+				pair := DecodeTable_RP[p]
+				return func(c *CPU) {
+					operandRegister := pair
+					if operandRegister == RegisterPairHL {
+						operandRegister = c.instruction.indexRegister
+					}
+					orig := c.Get16bitRegister(c.instruction.indexRegister)
+					operand := c.Get16bitRegister(operandRegister)
+					c.Set16bitRegister(c.instruction.indexRegister, c.Add16WithFlags(orig, operand))
+					c.WZ = orig + 1
+				}
+			}
+		} else if z == 2 && p == 2 {
+			if q == 0 {
+				// ld [nn], ix
+				return func(c *CPU) {
+					address := c.fetchOperand16()
+					value := c.Get16bitRegister(c.instruction.indexRegister)
+					c.Bus.WriteMemoryByte(address, uint8(value&0xFF))
+					c.Bus.WriteMemoryByte(address+1, uint8((value&0xFF00)>>8))
+					c.WZ = address + 1
+				}
+			}
+			// ld ix, [nn]
+			return func(c *CPU) {
+				address := c.fetchOperand16()
+				c.Set16bitRegister(c.instruction.indexRegister, registerPair(c.Bus.ReadMemoryByte(address+1), c.Bus.ReadMemoryByte(address)))
+				c.WZ = address + 1
+			}
+		} else if z == 3 && p == 2 {
+			if q == 0 {
+				// inc ix
+				return func(c *CPU) {
+					c.Set16bitRegister(c.instruction.indexRegister, c.Get16bitRegister(c.instruction.indexRegister)+1)
+				}
+			}
+			// dec ix
+			return func(c *CPU) {
+				c.Set16bitRegister(c.instruction.indexRegister, c.Get16bitRegister(c.instruction.indexRegister)-1)
+			}
+		} else if z == 4 && y == 6 {
+			// inc [ix+d]
+			return func(c *CPU) {
+				address := c.fetchIndexedAddress()
+				c.Bus.WriteMemoryByte(address, c.Increment8WithFlags(c.Bus.ReadMemoryByte(address)))
+			}
+		} else if z == 5 && y == 6 {
+			// dec [ix+d]
+			return func(c *CPU) {
+				address := c.fetchIndexedAddress()
+				c.Bus.WriteMemoryByte(address, c.Decrement8WithFlags(c.Bus.ReadMemoryByte(address)))
+			}
+		} else if z == 6 && y == 6 {
+			// ld [ix+d], n
+			return func(c *CPU) {
+				address := c.fetchIndexedAddress()
+				c.Bus.WriteMemoryByte(address, c.fetchOperand8())
+			}
+		}
+	case 1:
+		if z == 6 && y != 6 {
+			// ld r[y], [ix+d]
+			register := DecodeTable_R[y]
+			return func(c *CPU) {
+				c.Set8bitRegister(register, c.Bus.ReadMemoryByte(c.fetchIndexedAddress()))
+			}
+		} else if y == 6 && z != 6 {
+			// ld [ix+d], r[z]
+			register := DecodeTable_R[z]
+			return func(c *CPU) {
+				c.Bus.WriteMemoryByte(c.fetchIndexedAddress(), c.Get8bitRegister(register))
+			}
+		}
+	case 2:
+		if z == 6 {
+			// alu[y] [ix+d]
+			operation := DecodeTable_ALU[y]
+			return func(c *CPU) {
+				c.DoALUOperation(operation, c.Bus.ReadMemoryByte(c.fetchIndexedAddress()))
+			}
+		}
+	case 3:
+		if z == 1 {
+			if q == 0 && p == 2 {
+				// pop ix
+				return func(c *CPU) {
+					c.Set16bitRegister(c.instruction.indexRegister, c.popWord())
+				}
+			} else if q == 1 && p == 2 {
+				// jp ix
+				return func(c *CPU) {
+					c.jump(c.Get16bitRegister(c.instruction.indexRegister))
+				}
+			} else if q == 1 && p == 3 {
+				// ld sp, ix
+				return func(c *CPU) {
+					c.Registers.SP = c.Get16bitRegister(c.instruction.indexRegister)
+				}
+			}
+		} else if z == 3 && y == 4 {
+			// ex [sp], ix
+			return func(c *CPU) {
+				value := c.Get16bitRegister(c.instruction.indexRegister)
+				swapHigh := c.Bus.ReadMemoryByte(c.Registers.SP + 1)
+				swapLow := c.Bus.ReadMemoryByte(c.Registers.SP)
+				c.Bus.WriteMemoryByte(c.Registers.SP+1, uint8((value&0xFF00)>>8))
+				c.Bus.WriteMemoryByte(c.Registers.SP, uint8(value&0xFF))
+				c.Set16bitRegister(c.instruction.indexRegister, registerPair(swapHigh, swapLow))
+				c.WZ = registerPair(swapHigh, swapLow)
+			}
+		} else if z == 5 && q == 0 && p == 2 {
+			// push ix
+			return func(c *CPU) {
+				c.pushWord(c.Get16bitRegister(c.instruction.indexRegister))
+			}
+		}
+	}
+	return nil
+}
+
+// undocumented: when there's no [ix+d], h and l refer to the halves of the index register instead
+func (c *CPU) indexHalf(register Register8bitType) Register8bitType {
+	if c.instruction.indexRegister == RegisterPairIX {
+		if register == RegisterH {
+			return RegisterIXH
+		} else if register == RegisterL {
+			return RegisterIXL
+		}
+	} else {
+		if register == RegisterH {
+			return RegisterIYH
+		} else if register == RegisterL {
+			return RegisterIYL
+		}
+	}
+	return register
+}
+
+func undocumentedIndexHandler(x, y, z, p, q uint8) opcodeHandler {
+	if x == 0 && (y == 4 || y == 5) {
+		register := DecodeTable_R[y]
+		if z == 4 {
+			// inc ixh, inc ixl
+			return func(c *CPU) {
+				target := c.indexHalf(register)
+				c.Set8bitRegister(target, c.Increment8WithFlags(c.Get8bitRegister(target)))
+			}
+		} else if z == 5 {
+			// dec ixh, dec ixl
+			return func(c *CPU) {
+				target := c.indexHalf(register)
+				c.Set8bitRegister(target, c.Decrement8WithFlags(c.Get8bitRegister(target)))
+			}
+		} else if z == 6 {
+			// ld ixh, n
+			// ld ixl, n
+			return func(c *CPU) {
+				c.Set8bitRegister(c.indexHalf(register), c.fetchOperand8())
+			}
+		}
+	} else if x == 1 && (y == 4 || y == 5 || z == 4 || z == 5) {
+		// ld r[y], r[z], with ixh and ixl instead of h and l
+		target := DecodeTable_R[y]
+		source := DecodeTable_R[z]
+		return func(c *CPU) {
+			c.Set8bitRegister(c.indexHalf(target), c.Get8bitRegister(c.indexHalf(source)))
+		}
+	} else if x == 2 && (z == 4 || z == 5) {
+		// alu[y] ixh, alu[y] ixl
+		operation := DecodeTable_ALU[y]
+		operand := DecodeTable_R[z]
+		return func(c *CPU) {
+			c.DoALUOperation(operation, c.Get8bitRegister(c.indexHalf(operand)))
+		}
+	}
+
+	// undocumented: everything else runs as if there was no prefix
+	return unprefixedHandler(x, y, z, p, q)
+}
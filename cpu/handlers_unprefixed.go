@@ -0,0 +1,395 @@
+package cpu
+
+func unprefixedHandler(x, y, z, p, q uint8) opcodeHandler {
+	switch x {
+	case 0:
+		switch z {
+		case 0:
+			switch y {
+			case 0:
+				// nop
+				return func(c *CPU) {}
+			case 1:
+				// ex af, af'
+				return func(c *CPU) {
+					c.Swap8bitRegisterWithShadow(RegisterA)
+					flag := c.Registers.Flag
+					c.Registers.Flag = c.ShadowRegisters.Flag
+					c.ShadowRegisters.Flag = flag
+				}
+			case 2:
+				// djnz d
+				return func(c *CPU) {
+					target := c.fetchRelativeTarget()
+					c.Registers.B -= 1
+					if c.Registers.B != 0 {
+						c.WZ = target
+						c.jump(target)
+						c.instruction.extraCycles += CycleExtraJR
+					}
+				}
+			case 3:
+				// jr d
+				return func(c *CPU) {
+					c.WZ = c.fetchRelativeTarget()
+					c.jump(c.WZ)
+				}
+			default:
+				// jr cc[y-4], d
+				condition := DecodeTable_CC[y-4]
+				return func(c *CPU) {
+					target := c.fetchRelativeTarget()
+					if c.ConditionMet(condition) {
+						c.WZ = target
+						c.jump(target)
+						c.instruction.extraCycles += CycleExtraJR
+					}
+				}
+			}
+		case 1:
+			pair := DecodeTable_RP[p]
+			if q == 0 {
+				// ld rp[p], nn
+				return func(c *CPU) {
+					c.Set16bitRegister(pair, c.fetchOperand16())
+				}
+			}
+			// add hl, rp[p]
+			return func(c *CPU) {
+				hl := c.Get16bitRegister(RegisterPairHL)
+				operand := c.Get16bitRegister(pair)
+				c.Set16bitRegister(RegisterPairHL, c.Add16WithFlags(hl, operand))
+				c.WZ = hl + 1
+			}
+		case 2:
+			return unprefixedIndirectLoadHandler(p, q)
+		case 3:
+			pair := DecodeTable_RP[p]
+			if q == 0 {
+				// inc rp[p]
+				return func(c *CPU) {
+					c.Set16bitRegister(pair, c.Get16bitRegister(pair)+1)
+				}
+			}
+			// dec rp[p]
+			return func(c *CPU) {
+				c.Set16bitRegister(pair, c.Get16bitRegister(pair)-1)
+			}
+		case 4:
+			// inc r[y]
+			register := DecodeTable_R[y]
+			return func(c *CPU) {
+				c.Set8bitRegister(register, c.Increment8WithFlags(c.Get8bitRegister(register)))
+			}
+		case 5:
+			// dec r[y]
+			register := DecodeTable_R[y]
+			return func(c *CPU) {
+				c.Set8bitRegister(register, c.Decrement8WithFlags(c.Get8bitRegister(register)))
+			}
+		case 6:
+			// ld r[y], n
+			register := DecodeTable_R[y]
+			return func(c *CPU) {
+				c.Set8bitRegister(register, c.fetchOperand8())
+			}
+		case 7:
+			return unprefixedAccumulatorHandler(y)
+		}
+	case 1:
+		if z == 6 && y == 6 {
+			// halt
+			return func(c *CPU) {
+				c.Halted = true
+			}
+		}
+
+		// ld r[y], r[z]
+		target := DecodeTable_R[y]
+		source := DecodeTable_R[z]
+		if target == RegisterB && source == RegisterB {
+			// it's a breakpoint
+			return func(c *CPU) {
+				c.instruction.breakpointTrigger()
+			}
+		}
+		return func(c *CPU) {
+			c.Set8bitRegister(target, c.Get8bitRegister(source))
+		}
+	case 2:
+		// alu[y] r[z]
+		operation := DecodeTable_ALU[y]
+		operand := DecodeTable_R[z]
+		return func(c *CPU) {
+			c.DoALUOperation(operation, c.Get8bitRegister(operand))
+		}
+	case 3:
+		switch z {
+		case 0:
+			// ret cc[y]
+			condition := DecodeTable_CC[y]
+			return func(c *CPU) {
+				if c.ConditionMet(condition) {
+					c.ret()
+					c.instruction.extraCycles += CycleExtraRet
+				}
+			}
+		case 1:
+			if q == 0 {
+				// pop rp2[p]
+				pair := DecodeTable_RP2[p]
+				return func(c *CPU) {
+					c.Set16bitRegister(pair, c.popWord())
+				}
+			}
+			switch p {
+			case 0:
+				// ret
+				return func(c *CPU) {
+					c.ret()
+				}
+			case 1:
+				// exx
+				return func(c *CPU) {
+					c.Swap8bitRegisterWithShadow(RegisterB)
+					c.Swap8bitRegisterWithShadow(RegisterC)
+
+					c.Swap8bitRegisterWithShadow(RegisterD)
+					c.Swap8bitRegisterWithShadow(RegisterE)
+
+					c.Swap8bitRegisterWithShadow(RegisterH)
+					c.Swap8bitRegisterWithShadow(RegisterL)
+				}
+			case 2:
+				// jp hl
+				return func(c *CPU) {
+					c.jump(registerPair(c.Registers.H, c.Registers.L))
+				}
+			case 3:
+				// ld sp, hl
+				return func(c *CPU) {
+					c.Registers.SP = registerPair(c.Registers.H, c.Registers.L)
+				}
+			}
+		case 2:
+			// jp cc[y], nn
+			condition := DecodeTable_CC[y]
+			return func(c *CPU) {
+				c.WZ = c.fetchOperand16()
+				if c.ConditionMet(condition) {
+					c.jump(c.WZ)
+				}
+			}
+		case 3:
+			return unprefixedMiscHandler(y)
+		case 4:
+			// call cc[y], nn
+			condition := DecodeTable_CC[y]
+			return func(c *CPU) {
+				c.WZ = c.fetchOperand16()
+				if c.ConditionMet(condition) {
+					c.call(c.WZ)
+					c.instruction.extraCycles += CycleExtraCall
+				}
+			}
+		case 5:
+			if q == 0 {
+				// push rp2[p]
+				pair := DecodeTable_RP2[p]
+				return func(c *CPU) {
+					c.pushWord(c.Get16bitRegister(pair))
+				}
+			}
+			if p == 0 {
+				// call nn
+				return func(c *CPU) {
+					c.WZ = c.fetchOperand16()
+					c.call(c.WZ)
+				}
+			}
+			// the other ones are prefixes, which never get here
+			return nil
+		case 6:
+			// alu[y] n
+			operation := DecodeTable_ALU[y]
+			return func(c *CPU) {
+				c.DoALUOperation(operation, c.fetchOperand8())
+			}
+		case 7:
+			// rst y*8
+			target := uint16(y) * 8
+			return func(c *CPU) {
+				c.WZ = target
+				c.call(target)
+			}
+		}
+	}
+	return nil
+}
+
+// x = 0, z = 2
+func unprefixedIndirectLoadHandler(p, q uint8) opcodeHandler {
+	if q == 0 {
+		switch p {
+		case 0:
+			// ld [bc], a
+			return func(c *CPU) {
+				c.Bus.WriteMemoryByte(registerPair(c.Registers.B, c.Registers.C), c.Registers.A)
+				c.WZ = registerPair(c.Registers.A, c.Registers.C+1)
+			}
+		case 1:
+			// ld [de], a
+			return func(c *CPU) {
+				c.Bus.WriteMemoryByte(registerPair(c.Registers.D, c.Registers.E), c.Registers.A)
+				c.WZ = registerPair(c.Registers.A, c.Registers.E+1)
+			}
+		case 2:
+			// ld [nn], hl
+			return func(c *CPU) {
+				address := c.fetchOperand16()
+				c.Bus.WriteMemoryByte(address, c.Registers.L)
+				c.Bus.WriteMemoryByte(address+1, c.Registers.H)
+				c.WZ = address + 1
+			}
+		default:
+			// ld [nn], a
+			return func(c *CPU) {
+				address := c.fetchOperand16()
+				c.Bus.WriteMemoryByte(address, c.Registers.A)
+				c.WZ = registerPair(c.Registers.A, uint8(address)+1)
+			}
+		}
+	}
+
+	switch p {
+	case 0:
+		// ld a, [bc]
+		return func(c *CPU) {
+			address := registerPair(c.Registers.B, c.Registers.C)
+			c.Registers.A = c.Bus.ReadMemoryByte(address)
+			c.WZ = address + 1
+		}
+	case 1:
+		// ld a, [de]
+		return func(c *CPU) {
+			address := registerPair(c.Registers.D, c.Registers.E)
+			c.Registers.A = c.Bus.ReadMemoryByte(address)
+			c.WZ = address + 1
+		}
+	case 2:
+		// ld hl, [nn]
+		return func(c *CPU) {
+			address := c.fetchOperand16()
+			c.Registers.L = c.Bus.ReadMemoryByte(address)
+			c.Registers.H = c.Bus.ReadMemoryByte(address + 1)
+			c.WZ = address + 1
+		}
+	default:
+		// ld a, [nn]
+		return func(c *CPU) {
+			address := c.fetchOperand16()
+			c.Registers.A = c.Bus.ReadMemoryByte(address)
+			c.WZ = address + 1
+		}
+	}
+}
+
+// x = 0, z = 7
+func unprefixedAccumulatorHandler(y uint8) opcodeHandler {
+	switch y {
+	case 0, 1, 2, 3:
+		// rlca, rrca, rla, rra
+		operation := DecodeTable_ROT[y]
+		return func(c *CPU) {
+			c.DoAccumulatorShiftOperation(operation)
+		}
+	case 4:
+		// daa
+		return func(c *CPU) {
+			c.DoDecimalAdjust()
+		}
+	case 5:
+		// cpl
+		return func(c *CPU) {
+			c.Registers.A = ^c.Registers.A
+			c.setFlag(FlagHalfCarry, true)
+			c.setFlag(FlagSubtract, true)
+			c.setXYFlags(c.Registers.A)
+		}
+	case 6:
+		// scf
+		return func(c *CPU) {
+			c.setFlag(FlagCarry, true)
+			c.setFlag(FlagHalfCarry, false)
+			c.setFlag(FlagSubtract, false)
+			c.setXYFlags(c.Registers.A)
+		}
+	default:
+		// ccf
+		return func(c *CPU) {
+			c.setFlag(FlagHalfCarry, c.getFlag(FlagCarry))
+			c.setFlag(FlagCarry, !c.getFlag(FlagCarry))
+			c.setFlag(FlagSubtract, false)
+			c.setXYFlags(c.Registers.A)
+		}
+	}
+}
+
+// x = 3, z = 3
+func unprefixedMiscHandler(y uint8) opcodeHandler {
+	switch y {
+	case 0:
+		// jp nn
+		return func(c *CPU) {
+			c.WZ = c.fetchOperand16()
+			c.jump(c.WZ)
+		}
+	case 1:
+		// cb prefix, never gets here
+		return nil
+	case 2:
+		// out [n], a
+		return func(c *CPU) {
+			port := c.fetchOperand8()
+			c.Bus.WriteIOByte(port, c.Registers.A)
+			c.WZ = registerPair(c.Registers.A, port+1)
+		}
+	case 3:
+		// in a, [n]
+		return func(c *CPU) {
+			port := c.fetchOperand8()
+			c.WZ = registerPair(c.Registers.A, port) + 1
+			c.Registers.A = c.Bus.ReadIOByte(port)
+		}
+	case 4:
+		// ex [sp], hl
+		return func(c *CPU) {
+			swapHigh := c.Bus.ReadMemoryByte(c.Registers.SP + 1)
+			swapLow := c.Bus.ReadMemoryByte(c.Registers.SP)
+			c.Bus.WriteMemoryByte(c.Registers.SP+1, c.Registers.H)
+			c.Bus.WriteMemoryByte(c.Registers.SP, c.Registers.L)
+			c.Registers.H = swapHigh
+			c.Registers.L = swapLow
+			c.WZ = registerPair(swapHigh, swapLow)
+		}
+	case 5:
+		// ex de, hl
+		return func(c *CPU) {
+			c.Registers.D, c.Registers.H = c.Registers.H, c.Registers.D
+			c.Registers.E, c.Registers.L = c.Registers.L, c.Registers.E
+		}
+	case 6:
+		// di
+		return func(c *CPU) {
+			c.IFF1 = false
+			c.IFF2 = false
+		}
+	default:
+		// ei
+		return func(c *CPU) {
+			c.IFF1 = true
+			c.IFF2 = true
+			c.EIDelay = true
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package cpu
+
+import (
+	"testing"
+
+	"github.com/thatoddmailbox/computer-emu/devices"
+)
+
+// these check the edge cases that ZEXDOC and ZEXALL would, for when they aren't in cpm/testdata
+
+// runProgram runs program from 0x0000 for the given number of instructions, with ram at 0xF000
+func runProgram(t *testing.T, program []byte, steps int, setup func(c *CPU)) *CPU {
+	t.Helper()
+
+	c := &CPU{}
+	rom := devices.NewI2716(0x0000)
+	ram := devices.NewKR537RU2()
+	c.Bus.MemoryDevices = append(c.Bus.MemoryDevices, rom, ram)
+	copy(rom.ROM[:], program)
+	c.Registers.SP = 0xFFFF
+	if setup != nil {
+		setup(c)
+	}
+
+	for i := 0; i < steps; i++ {
+		err := c.Step(func() {})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+func TestInstructionFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []byte
+		steps   int
+		setup   func(c *CPU)
+		a       uint8
+		flag    uint8
+	}{
+		// daa after add, with a half carry out of the low digit
+		{"daa add", []byte{0x3E, 0x15, 0xC6, 0x27, 0x27}, 3, nil, 0x42, FlagHalfCarry | FlagParityOverflow},
+		// daa after sub, which subtracts 6
+		{"daa sub", []byte{0x3E, 0x42, 0xD6, 0x15, 0x27}, 3, nil, 0x27, FlagY | FlagParityOverflow | FlagSubtract},
+		// daa that carries out of the high digit
+		{"daa carry", []byte{0x3E, 0x99, 0xC6, 0x01, 0x27}, 3, nil, 0x00, FlagZero | FlagHalfCarry | FlagParityOverflow | FlagCarry},
+
+		// adc a, 0 with the carry set, overflowing into the sign bit
+		{"adc overflow", []byte{0x3E, 0x7F, 0x37, 0xCE, 0x00}, 3, nil, 0x80, FlagSign | FlagHalfCarry | FlagParityOverflow},
+		// sbc a, 0 with the carry set, overflowing out of the sign bit
+		{"sbc overflow", []byte{0x3E, 0x80, 0x37, 0xDE, 0x00}, 3, nil, 0x7F, FlagY | FlagHalfCarry | FlagX | FlagParityOverflow | FlagSubtract},
+
+		// bit 0, (ix+0x10) takes x and y from the high byte of ix+0x10 (in wz), not from the byte it tested
+		{"bit indexed", []byte{0xDD, 0x21, 0xF0, 0xF7, 0x37, 0xDD, 0xCB, 0x10, 0x46}, 3, nil, 0x00, FlagZero | FlagY | FlagHalfCarry | FlagX | FlagParityOverflow | FlagCarry},
+		// bit 7, (hl) takes them from wz too, which ld a, (nn) set to nn+1
+		{"bit hl", []byte{0x21, 0x00, 0xF0, 0x3A, 0xFF, 0xF7, 0xCB, 0x7E}, 3, nil, 0x00, FlagZero | FlagY | FlagHalfCarry | FlagX | FlagParityOverflow},
+	}
+	for _, test := range tests {
+		c := runProgram(t, test.program, test.steps, test.setup)
+		if c.Registers.A != test.a || c.Registers.Flag != test.flag {
+			t.Errorf("%s: a was 0x%02X with flags %08b, expected 0x%02X with %08b", test.name, c.Registers.A, c.Registers.Flag, test.a, test.flag)
+		}
+	}
+}
+
+func TestSixteenBitOverflow(t *testing.T) {
+	// ld hl, 0x8000; ld de, 0x0001; or a; sbc hl, de
+	c := runProgram(t, []byte{0x21, 0x00, 0x80, 0x11, 0x01, 0x00, 0xB7, 0xED, 0x52}, 4, nil)
+	expected := uint8(FlagY | FlagHalfCarry | FlagX | FlagParityOverflow | FlagSubtract)
+	if c.Registers.H != 0x7F || c.Registers.L != 0xFF || c.Registers.Flag != expected {
+		t.Errorf("sbc hl, de: hl was 0x%02X%02X with flags %08b, expected 0x7FFF with %08b", c.Registers.H, c.Registers.L, c.Registers.Flag, expected)
+	}
+
+	// ld hl, 0x7FFF; ld bc, 0x0000; scf; adc hl, bc
+	c = runProgram(t, []byte{0x21, 0xFF, 0x7F, 0x01, 0x00, 0x00, 0x37, 0xED, 0x4A}, 4, nil)
+	expected = uint8(FlagSign | FlagHalfCarry | FlagParityOverflow)
+	if c.Registers.H != 0x80 || c.Registers.L != 0x00 || c.Registers.Flag != expected {
+		t.Errorf("adc hl, bc: hl was 0x%02X%02X with flags %08b, expected 0x8000 with %08b", c.Registers.H, c.Registers.L, c.Registers.Flag, expected)
+	}
+}
+
+func TestBlockInstructions(t *testing.T) {
+	source := []byte{0x08, 0x22, 0x33}
+	setup := func(c *CPU) {
+		for i, value := range source {
+			c.Bus.WriteMemoryByte(0xF000+uint16(i), value)
+		}
+	}
+
+	// ld hl, 0xF000; ld de, 0xF100; ld bc, 2; xor a; scf; ldir
+	c := runProgram(t, []byte{0x21, 0x00, 0xF0, 0x11, 0x00, 0xF1, 0x01, 0x02, 0x00, 0xAF, 0x37, 0xED, 0xB0}, 7, setup)
+	// x and y come from a plus the last byte copied, which is 0x22
+	expected := uint8(FlagZero | FlagY | FlagCarry)
+	if c.Registers.Flag != expected || c.Bus.ReadMemoryByte(0xF101) != 0x22 || c.Registers.B != 0 || c.Registers.C != 0 || c.PC != 0x000D {
+		t.Errorf("ldir: flags were %08b, expected %08b", c.Registers.Flag, expected)
+	}
+
+	// ld hl, 0xF000; ld bc, 3; ld a, 0x22; scf; cpir
+	c = runProgram(t, []byte{0x21, 0x00, 0xF0, 0x01, 0x03, 0x00, 0x3E, 0x22, 0x37, 0xED, 0xB1}, 6, setup)
+	// found with one byte left, so the overflow flag is still set
+	expected = uint8(FlagZero | FlagParityOverflow | FlagSubtract | FlagCarry)
+	if c.Registers.Flag != expected || c.Registers.L != 0x02 || c.Registers.C != 1 || c.PC != 0x000B {
+		t.Errorf("cpir: flags were %08b with hl at 0x%02X%02X, expected %08b with 0xF002", c.Registers.Flag, c.Registers.H, c.Registers.L, expected)
+	}
+}
+
+func TestInstructionCycles(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []byte
+		setup   func(c *CPU)
+		cycles  uint64
+	}{
+		{"nop", []byte{0x00}, nil, 4},
+		{"jr nz taken", []byte{0x20, 0x00}, nil, 12},
+		{"jr nz not taken", []byte{0x20, 0x00}, func(c *CPU) { c.Registers.Flag = FlagZero }, 7},
+		{"djnz taken", []byte{0x10, 0x00}, func(c *CPU) { c.Registers.B = 2 }, 13},
+		{"djnz not taken", []byte{0x10, 0x00}, func(c *CPU) { c.Registers.B = 1 }, 8},
+		{"call", []byte{0xCD, 0x00, 0x00}, nil, 17},
+		{"ret z taken", []byte{0xC8}, func(c *CPU) { c.Registers.Flag = FlagZero }, 11},
+		{"ret z not taken", []byte{0xC8}, nil, 5},
+		{"ld a, (ix+d)", []byte{0xDD, 0x7E, 0x00}, func(c *CPU) { c.Registers.IX = 0xF000 }, 19},
+		{"set 0, (iy+d)", []byte{0xFD, 0xCB, 0x00, 0xC6}, func(c *CPU) { c.Registers.IY = 0xF000 }, 23},
+		{"ldir repeating", []byte{0xED, 0xB0}, func(c *CPU) { c.Registers.H, c.Registers.D, c.Registers.C = 0xF0, 0xF1, 2 }, 21},
+		{"ldir done", []byte{0xED, 0xB0}, func(c *CPU) { c.Registers.H, c.Registers.D, c.Registers.C = 0xF0, 0xF1, 1 }, 16},
+		{"ex (sp), hl", []byte{0xE3}, func(c *CPU) { c.Registers.SP = 0xF000 }, 19},
+	}
+	for _, test := range tests {
+		c := runProgram(t, test.program, 1, test.setup)
+		if c.Cycles != test.cycles {
+			t.Errorf("%s took %d t-states, expected %d", test.name, c.Cycles, test.cycles)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package cpu
+
+func (c *CPU) acceptNMI() {
+	c.incrementRefresh(1)
+	c.Halted = false
+	c.IFF1 = false
+	c.pushWord(c.PC)
+	c.PC = 0x0066
+	c.WZ = c.PC
+	c.Cycles += 11
+}
+
+func (c *CPU) acceptInterrupt() error {
+	data := c.Bus.AcknowledgeInterrupt()
+
+	mode := c.InterruptMode
+	if c.Variant == CPUVariant8080 {
+		// the 8080 only has what the z80 calls mode 0
+		mode = 0
+	}
+
+	// the device is meant to put an instruction on the data bus in mode 0, but the only ones we support are rsts
+	// (which includes 0xFF, for when nothing drives the bus)
+	// this is checked before anything changes, so the cpu is left as it was
+	if mode == 0 && data&0xC7 != 0xC7 {
+		return &ExecutionError{
+			PC:    c.PC,
+			Bytes: []byte{data},
+			Err:   ErrNotImplemented,
+		}
+	}
+
+	c.incrementRefresh(1)
+	c.Halted = false
+	c.IFF1 = false
+	c.IFF2 = false
+
+	switch mode {
+	case 0:
+		c.pushWord(c.PC)
+		c.PC = uint16(data & 0x38)
+		if c.Variant == CPUVariant8080 {
+			c.Cycles += 11
+		} else {
+			c.Cycles += 13
+		}
+	case 1:
+		c.pushWord(c.PC)
+		c.PC = 0x0038
+		c.Cycles += 13
+	case 2:
+		vector := registerPair(c.Registers.I, data)
+		c.pushWord(c.PC)
+		c.PC = registerPair(c.Bus.ReadMemoryByte(vector+1), c.Bus.ReadMemoryByte(vector))
+		c.Cycles += 19
+	}
+	c.WZ = c.PC
+
+	return nil
+}
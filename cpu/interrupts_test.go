@@ -0,0 +1,36 @@
+package cpu
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/thatoddmailbox/computer-emu/bus"
+	"github.com/thatoddmailbox/computer-emu/devices"
+)
+
+// an interrupt in mode 0 that isn't an rst can't be run, and shouldn't change anything, so that it can be looked at
+func TestUnsupportedModeZeroInterrupt(t *testing.T) {
+	c := CPU{}
+	ram := devices.NewKR537RU2()
+	c.Bus.MemoryDevices = append(c.Bus.MemoryDevices, ram)
+	c.Bus.Interrupts = bus.NewInterruptLines()
+	c.PC = 0xF000
+	c.Registers.SP = 0xF800
+	c.Registers.R = 0x12
+	c.IFF1 = true
+	c.IFF2 = true
+	c.Halted = true
+
+	// call 0x1234
+	c.Bus.Interrupts.Assert(ram, 0xCD)
+	before := c
+	err := c.Step(func() {})
+
+	var executionError *ExecutionError
+	if !errors.As(err, &executionError) || !errors.Is(err, ErrNotImplemented) {
+		t.Fatalf("expected an ExecutionError wrapping ErrNotImplemented, got %v", err)
+	}
+	if c.PC != before.PC || c.Registers != before.Registers || c.IFF1 != before.IFF1 || c.IFF2 != before.IFF2 || c.Halted != before.Halted || c.Cycles != before.Cycles {
+		t.Errorf("the cpu changed from %+v to %+v", before.Registers, c.Registers)
+	}
+}
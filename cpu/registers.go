@@ -18,6 +18,14 @@ func (c *CPU) Get8bitRegister(reg Register8bitType) uint8 {
 		return c.Registers.L
 	case RegisterIndirectHL:
 		return c.Bus.ReadMemoryByte(registerPair(c.Registers.H, c.Registers.L))
+	case RegisterIXH:
+		return uint8(c.Registers.IX >> 8)
+	case RegisterIXL:
+		return uint8(c.Registers.IX)
+	case RegisterIYH:
+		return uint8(c.Registers.IY >> 8)
+	case RegisterIYL:
+		return uint8(c.Registers.IY)
 	default:
 		panic("cpu: unknown register passed to Get8bitRegister")
 	}
@@ -64,6 +72,14 @@ func (c *CPU) Set8bitRegister(reg Register8bitType, val uint8) {
 		c.Registers.L = val
 	case RegisterIndirectHL:
 		c.Bus.WriteMemoryByte(registerPair(c.Registers.H, c.Registers.L), val)
+	case RegisterIXH:
+		c.Registers.IX = (c.Registers.IX & 0x00FF) | (uint16(val) << 8)
+	case RegisterIXL:
+		c.Registers.IX = (c.Registers.IX & 0xFF00) | uint16(val)
+	case RegisterIYH:
+		c.Registers.IY = (c.Registers.IY & 0x00FF) | (uint16(val) << 8)
+	case RegisterIYL:
+		c.Registers.IY = (c.Registers.IY & 0xFF00) | uint16(val)
 	default:
 		panic("cpu: unknown register passed to Set8bitRegister")
 	}
@@ -110,6 +126,10 @@ func (c *CPU) Get16bitRegister(reg RegisterPairType) uint16 {
 		return (uint16(c.Registers.H) << 8) | uint16(c.Registers.L)
 	case RegisterPairSP:
 		return c.Registers.SP
+	case RegisterPairIX:
+		return c.Registers.IX
+	case RegisterPairIY:
+		return c.Registers.IY
 	default:
 		panic("cpu: unknown register passed to Get16bitRegister")
 	}
@@ -133,6 +153,10 @@ func (c *CPU) Set16bitRegister(reg RegisterPairType, val uint16) {
 		c.Registers.L = low
 	case RegisterPairSP:
 		c.Registers.SP = val
+	case RegisterPairIX:
+		c.Registers.IX = val
+	case RegisterPairIY:
+		c.Registers.IY = val
 	default:
 		panic("cpu: unknown register passed to Set16bitRegister")
 	}
@@ -0,0 +1,68 @@
+package cpu
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// State is everything about the cpu that isn't on the bus, laid out for encoding/binary.
+// It's a plain value, so it's cheap to keep lots of them around.
+type State struct {
+	Variant         uint8
+	Registers       RegisterFile
+	ShadowRegisters RegisterFile
+	PC              uint16
+	IFF1            bool
+	IFF2            bool
+	InterruptMode   uint8
+	EIDelay         bool
+	Halted          bool
+	WZ              uint16
+	Cycles          uint64
+}
+
+func (c *CPU) State() State {
+	return State{
+		Variant:         uint8(c.Variant),
+		Registers:       c.Registers,
+		ShadowRegisters: c.ShadowRegisters,
+		PC:              c.PC,
+		IFF1:            c.IFF1,
+		IFF2:            c.IFF2,
+		InterruptMode:   c.InterruptMode,
+		EIDelay:         c.EIDelay,
+		Halted:          c.Halted,
+		WZ:              c.WZ,
+		Cycles:          c.Cycles,
+	}
+}
+
+func (c *CPU) SetState(state State) {
+	c.Variant = CPUVariantType(state.Variant)
+	c.Registers = state.Registers
+	c.ShadowRegisters = state.ShadowRegisters
+	c.PC = state.PC
+	c.IFF1 = state.IFF1
+	c.IFF2 = state.IFF2
+	c.InterruptMode = state.InterruptMode
+	c.EIDelay = state.EIDelay
+	c.Halted = state.Halted
+	c.WZ = state.WZ
+	c.Cycles = state.Cycles
+}
+
+// SaveState writes the registers and interrupt state, but not anything on the bus.
+func (c *CPU) SaveState(w io.Writer) error {
+	state := c.State()
+	return binary.Write(w, binary.LittleEndian, &state)
+}
+
+func (c *CPU) LoadState(r io.Reader) error {
+	state := State{}
+	err := binary.Read(r, binary.LittleEndian, &state)
+	if err != nil {
+		return err
+	}
+	c.SetState(state)
+	return nil
+}
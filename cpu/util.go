@@ -1,19 +1,20 @@
 package cpu
 
-import (
-	"strconv"
-)
+// parityTable[n] is true if n has an even number of set bits
+var parityTable [256]bool
 
-func calcParity(p uint8) bool {
-	// shhh it works
-	str := strconv.FormatUint(uint64(p), 2)
-	count := 0
-	for _, c := range str {
-		if c == '1' {
-			count++
+func init() {
+	for i := 0; i < 256; i++ {
+		count := 0
+		for value := i; value != 0; value >>= 1 {
+			count += value & 1
 		}
+		parityTable[i] = (count%2 == 0)
 	}
-	return (count % 2) == 0
+}
+
+func calcParity(p uint8) bool {
+	return parityTable[p]
 }
 
 func registerPair(h uint8, l uint8) uint16 {
@@ -30,4 +31,4 @@ func (c *CPU) setFlag(flag uint8, val bool) {
 	} else {
 		c.Registers.Flag &= ^flag
 	}
-}
\ No newline at end of file
+}
@@ -5,14 +5,27 @@ import (
 	"log"
 	"os/user"
 	"strconv"
+	"strings"
 	"sync"
 
+	"github.com/thatoddmailbox/computer-emu/breakpoints"
 	"github.com/thatoddmailbox/computer-emu/cpu"
+	"github.com/thatoddmailbox/computer-emu/replay"
+	"github.com/thatoddmailbox/computer-emu/rewind"
 
 	"github.com/veandco/go-sdl2/sdl"
 	"github.com/veandco/go-sdl2/ttf"
 )
 
+// what's being typed into the debugger window
+type inputMode int
+
+const (
+	inputNone inputMode = iota
+	inputAssemble
+	inputBreakpoint
+)
+
 type DebuggerState struct {
 	CPU cpu.CPU
 }
@@ -23,6 +36,18 @@ type Debugger struct {
 	CPUMutex         *sync.Mutex
 	SingleStep       bool
 	breakpointResume func()
+
+	// the error from the last step, if it failed
+	Fault error
+
+	// nil if stepping back is turned off
+	History *rewind.History
+
+	// patching memory is refused while these are recorded or replayed, and can be nil
+	Inputs *replay.Inputs
+
+	// checked by the cpu loop before each instruction, while holding CPUMutex
+	Breakpoints *breakpoints.List
 }
 
 func NewDebugger(sim *cpu.CPU, cpuMutex *sync.Mutex, breakpointResume func()) *Debugger {
@@ -31,7 +56,27 @@ func NewDebugger(sim *cpu.CPU, cpuMutex *sync.Mutex, breakpointResume func()) *D
 		CPUMutex:         cpuMutex,
 		StepChannel:      make(chan bool),
 		breakpointResume: breakpointResume,
+		Breakpoints:      breakpoints.NewList(),
+	}
+}
+
+// addBreakpoint adds a breakpoint from a line like "loop+0x3 if a==3 && [0xF004]>0x10"
+func (d *Debugger) addBreakpoint(line string) (string, error) {
+	location := line
+	condition := ""
+	if index := strings.Index(line, " if "); index != -1 {
+		location = line[:index]
+		condition = line[index+4:]
+	}
+
+	d.CPUMutex.Lock()
+	defer d.CPUMutex.Unlock()
+
+	breakpoint, err := d.Breakpoints.Add(location, condition, d.CPU.Symbols)
+	if err != nil {
+		return "", err
 	}
+	return "Added breakpoint at " + d.CPU.Symbols.Format(breakpoint.Address), nil
 }
 
 func (d *Debugger) drawText(renderer *sdl.Renderer, font *ttf.Font, text string, x int, y int) error {
@@ -110,11 +155,19 @@ func (d *Debugger) Loop(callback func()) {
 		running := true
 
 		lastPC := uint16(0xFFFF)
-		info := cpu.InstructionInfo{}
-		formattedParams := ""
+		instruction := cpu.Instruction{}
 		dirty := true
 		lastSingleStep := d.SingleStep
 
+		// the line assembler, for patching memory while stopped, or a new breakpoint
+		input := inputNone
+		assembleAddress := uint16(0)
+		inputLine := ""
+		inputMessage := ""
+
+		// the breakpoint that e and x apply to
+		selectedBreakpoint := 0
+
 		// disassemblyAddress := []uint16{}
 		// disassemblyResults := []cpu.InstructionInfo{}
 
@@ -122,14 +175,112 @@ func (d *Debugger) Loop(callback func()) {
 			sdl.Do(func() {
 				for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
 					switch event.(type) {
+					case *sdl.TextInputEvent:
+						if input != inputNone {
+							dirty = true
+							inputLine += event.(*sdl.TextInputEvent).GetText()
+						}
 					case *sdl.KeyboardEvent:
 						e := event.(*sdl.KeyboardEvent)
-						if e.State == sdl.RELEASED {
+						if input != inputNone {
+							if e.State != sdl.PRESSED {
+								continue
+							}
+							dirty = true
+							if e.Keysym.Sym == sdl.K_RETURN && input == inputAssemble {
+								nextAddress, message, err := d.patch(assembleAddress, inputLine)
+								if err != nil {
+									inputMessage = err.Error()
+								} else {
+									assembleAddress = nextAddress
+									inputLine = ""
+									inputMessage = message
+									lastPC = 0xFFFF
+								}
+							} else if e.Keysym.Sym == sdl.K_RETURN && input == inputBreakpoint {
+								message, err := d.addBreakpoint(inputLine)
+								if err != nil {
+									inputMessage = err.Error()
+								} else {
+									inputLine = ""
+									inputMessage = message
+								}
+							} else if e.Keysym.Sym == sdl.K_BACKSPACE {
+								if len(inputLine) > 0 {
+									inputLine = inputLine[:len(inputLine)-1]
+								}
+							} else if e.Keysym.Sym == sdl.K_ESCAPE {
+								input = inputNone
+								sdl.StopTextInput()
+							}
+						} else if e.State == sdl.PRESSED && (e.Keysym.Sym == sdl.K_UP || e.Keysym.Sym == sdl.K_DOWN) {
+							// pressed rather than released, so that holding it down repeats
+							if d.SingleStep {
+								dirty = true
+								if e.Keysym.Sym == sdl.K_UP && selectedBreakpoint > 0 {
+									selectedBreakpoint -= 1
+								} else if e.Keysym.Sym == sdl.K_DOWN {
+									selectedBreakpoint += 1
+								}
+							}
+						} else if e.State == sdl.RELEASED {
 							if e.Keysym.Sym == sdl.K_SPACE {
 								if d.SingleStep {
 									dirty = true
 									d.StepChannel <- true
 								}
+							} else if e.Keysym.Sym == sdl.K_b {
+								if d.SingleStep && d.History != nil {
+									dirty = true
+									d.CPUMutex.Lock()
+									d.History.StepBack()
+									d.Fault = nil
+									d.CPUMutex.Unlock()
+								}
+							} else if e.Keysym.Sym == sdl.K_v {
+								if d.SingleStep && d.History != nil {
+									// reverse continue, stopping right before the last breakpoint that ran
+									dirty = true
+									d.CPUMutex.Lock()
+									d.History.StepBackUntil(func(c *cpu.CPU) bool {
+										return c.Bus.PeekMemoryByte(c.PC) == 0x40 || d.Breakpoints.Matches(c) != nil // ld b, b
+									})
+									d.Fault = nil
+									d.CPUMutex.Unlock()
+								}
+							} else if e.Keysym.Sym == sdl.K_a {
+								if d.SingleStep {
+									dirty = true
+									input = inputAssemble
+									d.CPUMutex.Lock()
+									assembleAddress = d.CPU.PC
+									d.CPUMutex.Unlock()
+									inputLine = ""
+									inputMessage = "Enter to write, .org to move, Esc to stop"
+									sdl.StartTextInput()
+								}
+							} else if e.Keysym.Sym == sdl.K_n {
+								if d.SingleStep {
+									dirty = true
+									input = inputBreakpoint
+									inputLine = ""
+									inputMessage = "Address or label, then optionally: if a==3 && [0xF004]>0x10"
+									sdl.StartTextInput()
+								}
+							} else if e.Keysym.Sym == sdl.K_e {
+								if d.SingleStep {
+									dirty = true
+									d.CPUMutex.Lock()
+									d.Breakpoints.Toggle(selectedBreakpoint)
+									d.CPUMutex.Unlock()
+								}
+							} else if e.Keysym.Sym == sdl.K_x || e.Keysym.Sym == sdl.K_DELETE {
+								if d.SingleStep {
+									dirty = true
+									d.CPUMutex.Lock()
+									d.Breakpoints.Remove(selectedBreakpoint)
+									d.CPUMutex.Unlock()
+								}
 							} else if e.Keysym.Sym == sdl.K_r {
 								if d.SingleStep {
 									dirty = true
@@ -176,13 +327,65 @@ func (d *Debugger) Loop(callback func()) {
 					d.drawText(renderer, font12, "Flags: "+fmt.Sprintf("%08b", d.CPU.Registers.Flag), 0, 24)
 					d.drawText(renderer, font12, "PC: 0x"+fmt.Sprintf("%04X", d.CPU.PC), 160, 24)
 					d.drawText(renderer, font12, "SP: 0x"+fmt.Sprintf("%04X", d.CPU.Registers.SP), 240, 24)
+					d.drawText(renderer, font12, "I: 0x"+fmt.Sprintf("%02X", d.CPU.Registers.I), 320, 24)
+					d.drawText(renderer, font12, "R: 0x"+fmt.Sprintf("%02X", d.CPU.Registers.R), 400, 24)
+					if d.History != nil {
+						d.drawText(renderer, font12, "Back: "+strconv.Itoa(d.History.Len()), 480, 24)
+					}
 
 					if lastPC != d.CPU.PC {
-						info, formattedParams, _ = cpu.DisassembleInstructionAt(d.CPU, d.CPU.PC)
+						instruction = cpu.DisassembleAt(d.CPU, d.CPU.PC)
 						lastPC = d.CPU.PC
 					}
 
-					d.drawText(renderer, font12, info.Mnemonic+" "+formattedParams, 0, 40)
+					disassembly := instruction.Format(d.CPU.Symbols)
+					if _, ok := d.CPU.Symbols.Lookup(d.CPU.PC); ok {
+						disassembly = d.CPU.Symbols.Format(d.CPU.PC) + ": " + disassembly
+					}
+					d.drawText(renderer, font12, disassembly, 0, 40)
+
+					if d.Fault != nil {
+						d.drawText(renderer, font12, "Fault: "+d.Fault.Error(), 0, 52)
+					}
+
+					if input == inputAssemble {
+						d.drawText(renderer, font12, fmt.Sprintf("Assemble at 0x%04X: %s_", assembleAddress, inputLine), 0, 72)
+						d.drawText(renderer, font12, inputMessage, 0, 84)
+					} else if input == inputBreakpoint {
+						d.drawText(renderer, font12, "New breakpoint: "+inputLine+"_", 0, 72)
+						d.drawText(renderer, font12, inputMessage, 0, 84)
+					}
+
+					breakpointList := d.Breakpoints.Breakpoints()
+					if selectedBreakpoint >= len(breakpointList) {
+						selectedBreakpoint = len(breakpointList) - 1
+					}
+					if selectedBreakpoint < 0 {
+						selectedBreakpoint = 0
+					}
+					d.drawText(renderer, font12, "Breakpoints (n: new, e: enable/disable, x: remove)", 0, 104)
+					for i, breakpoint := range breakpointList {
+						y := 116 + (i * 12)
+						if y > 300-12 {
+							break
+						}
+						selected := " "
+						if i == selectedBreakpoint {
+							selected = ">"
+						}
+						enabled := "[ ]"
+						if breakpoint.Enabled {
+							enabled = "[x]"
+						}
+						location := fmt.Sprintf("0x%04X", breakpoint.Address)
+						if _, ok := d.CPU.Symbols.Lookup(breakpoint.Address); ok {
+							location += " (" + d.CPU.Symbols.Format(breakpoint.Address) + ")"
+						}
+						if breakpoint.Condition != "" {
+							location += " if " + breakpoint.Condition
+						}
+						d.drawText(renderer, font12, fmt.Sprintf("%s %s %s  hits: %d", selected, enabled, location, breakpoint.Hits), 0, y)
+					}
 
 					// d.drawText(renderer, font12, fmt.Sprintf("dropping: 0x%x, fall index: %d, random: %d", d.CPU.Bus.ReadMemoryByte(0xF004), d.CPU.Bus.ReadMemoryByte(0xF007), d.CPU.Bus.ReadMemoryByte(0xF002)), 0, 64)
 					// d.drawText(renderer, font12, "tetris board:", 0, 76)
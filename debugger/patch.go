@@ -0,0 +1,51 @@
+package debugger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/thatoddmailbox/computer-emu/cpu"
+	"github.com/thatoddmailbox/computer-emu/replay"
+)
+
+// patch assembles line and writes it to memory at address, returning where the next instruction goes.
+// A line like .org 0x1234 moves to another address instead.
+func (d *Debugger) patch(address uint16, line string) (uint16, string, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 2 && strings.ToLower(fields[0]) == ".org" {
+		newAddress, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(fields[1]), "0x"), 16, 16)
+		if err != nil {
+			return address, "", fmt.Errorf("invalid address '%s'", fields[1])
+		}
+		return uint16(newAddress), "", nil
+	}
+
+	d.CPUMutex.Lock()
+	defer d.CPUMutex.Unlock()
+
+	if d.Inputs.Active() {
+		// the replay would go differently
+		return address, "", replay.ErrActive
+	}
+
+	assembled, err := cpu.Assemble(line, address, d.CPU.Symbols)
+	if err != nil {
+		return address, "", err
+	}
+
+	for i, value := range assembled {
+		err = d.CPU.Bus.PokeMemoryByte(address+uint16(i), value)
+		if err != nil {
+			// some of it might have been written, like when it runs into something that isn't memory
+			return address, "", err
+		}
+	}
+
+	if d.History != nil {
+		// stepping back over the patch would half undo it
+		d.History.Clear()
+	}
+
+	return address + uint16(len(assembled)), fmt.Sprintf("Wrote % X to 0x%04X", assembled, address), nil
+}
@@ -1,11 +1,20 @@
 package devices
 
+import (
+	"io"
+	"time"
+)
+
 type AS6C62256 struct {
+	Timing
+
 	RAM [4 * 1024]byte
 }
 
 func NewAS6C62256() *AS6C62256 {
-	return &AS6C62256{}
+	return &AS6C62256{
+		Timing: Timing{Access: 55 * time.Nanosecond},
+	}
 }
 
 func (r *AS6C62256) IsMapped(address uint16) bool {
@@ -21,7 +30,28 @@ func (r *AS6C62256) ReadByte(address uint16) uint8 {
 	return r.RAM[accessAddress]
 }
 
-func (r *AS6C62256) WriteByte(address uint16, data uint8) {
+// reading doesn't change anything, so this is the same as ReadByte
+func (r *AS6C62256) PeekByte(address uint16) uint8 {
+	return r.ReadByte(address)
+}
+
+// nothing stops anything writing to ram, so this is the same as WriteByte
+func (r *AS6C62256) PokeByte(address uint16, data uint8) error {
+	return r.WriteByte(address, data)
+}
+
+func (r *AS6C62256) WriteByte(address uint16, data uint8) error {
 	accessAddress := address & 0x0FFF
 	r.RAM[accessAddress] = data
+	return nil
+}
+
+func (r *AS6C62256) SaveState(w io.Writer) error {
+	_, err := w.Write(r.RAM[:])
+	return err
+}
+
+func (r *AS6C62256) LoadState(rd io.Reader) error {
+	_, err := io.ReadFull(rd, r.RAM[:])
+	return err
 }
@@ -1,18 +1,23 @@
 package devices
 
 import (
-	"errors"
+	"encoding/binary"
+	"io"
+	"time"
 )
 
 // in the rom0 slot
 
 type AT28C256 struct {
+	Timing
+
 	ROM      [32 * 1024]byte
 	ReadOnly bool
 }
 
 func NewAT28C256() *AT28C256 {
 	return &AT28C256{
+		Timing:   Timing{Access: 150 * time.Nanosecond},
 		ReadOnly: true,
 	}
 }
@@ -40,9 +45,23 @@ func (r *AT28C256) ReadByte(address uint16) uint8 {
 	return r.ROM[accessAddress]
 }
 
-func (r *AT28C256) WriteByte(address uint16, data uint8) {
+// reading doesn't change anything, so this is the same as ReadByte
+func (r *AT28C256) PeekByte(address uint16) uint8 {
+	return r.ReadByte(address)
+}
+
+// an eeprom can be reprogrammed, so this writes to it even when it's read only to the cpu
+func (r *AT28C256) PokeByte(address uint16, data uint8) error {
+	readOnly := r.ReadOnly
+	r.ReadOnly = false
+	err := r.WriteByte(address, data)
+	r.ReadOnly = readOnly
+	return err
+}
+
+func (r *AT28C256) WriteByte(address uint16, data uint8) error {
 	if r.ReadOnly {
-		panic(errors.New("at28c256: write to ROM"))
+		return ErrWriteToROM
 	}
 
 	accessAddress := address & 0x0FFF
@@ -57,4 +76,22 @@ func (r *AT28C256) WriteByte(address uint16, data uint8) {
 	}
 
 	r.ROM[accessAddress] = data
+	return nil
+}
+
+// the contents are saved too, since they can be written to
+func (r *AT28C256) SaveState(w io.Writer) error {
+	_, err := w.Write(r.ROM[:])
+	if err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, r.ReadOnly)
+}
+
+func (r *AT28C256) LoadState(rd io.Reader) error {
+	_, err := io.ReadFull(rd, r.ROM[:])
+	if err != nil {
+		return err
+	}
+	return binary.Read(rd, binary.LittleEndian, &r.ReadOnly)
 }
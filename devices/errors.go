@@ -0,0 +1,8 @@
+package devices
+
+import (
+	"errors"
+)
+
+var ErrWriteToROM = errors.New("devices: write to ROM")
+var ErrModeNotImplemented = errors.New("devices: non-zero modes not implemented")
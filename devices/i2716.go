@@ -1,10 +1,14 @@
 package devices
 
 import (
-	"errors"
+	"encoding/binary"
+	"io"
+	"time"
 )
 
 type I2716 struct {
+	Timing
+
 	baseAddress uint16
 	ROM         [2 * 1024]byte
 	ReadOnly    bool
@@ -12,6 +16,7 @@ type I2716 struct {
 
 func NewI2716(baseAddress uint16) *I2716 {
 	return &I2716{
+		Timing:      Timing{Access: 450 * time.Nanosecond},
 		baseAddress: baseAddress,
 		ReadOnly:    false,
 	}
@@ -30,10 +35,38 @@ func (r *I2716) ReadByte(address uint16) uint8 {
 	return r.ROM[accessAddress]
 }
 
-func (r *I2716) WriteByte(address uint16, data uint8) {
+// reading doesn't change anything, so this is the same as ReadByte
+func (r *I2716) PeekByte(address uint16) uint8 {
+	return r.ReadByte(address)
+}
+
+// an eprom can't be erased without taking it out, so this only works if the cpu could write to it anyway
+func (r *I2716) PokeByte(address uint16, data uint8) error {
+	return r.WriteByte(address, data)
+}
+
+func (r *I2716) WriteByte(address uint16, data uint8) error {
 	if r.ReadOnly {
-		panic(errors.New("i2716: write to ROM"))
+		return ErrWriteToROM
 	}
 	accessAddress := address & 0x07FF
 	r.ROM[accessAddress] = data
+	return nil
+}
+
+// the contents are saved too, since they can be written to
+func (r *I2716) SaveState(w io.Writer) error {
+	_, err := w.Write(r.ROM[:])
+	if err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, r.ReadOnly)
+}
+
+func (r *I2716) LoadState(rd io.Reader) error {
+	_, err := io.ReadFull(rd, r.ROM[:])
+	if err != nil {
+		return err
+	}
+	return binary.Read(rd, binary.LittleEndian, &r.ReadOnly)
 }
@@ -2,20 +2,79 @@ package devices
 
 import (
 	"bufio"
+	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
+	"sync"
+
+	"github.com/thatoddmailbox/computer-emu/bus"
 )
 
 type I8251 struct {
 	reader *bufio.Reader
+
+	// called with bytes from stdin, instead of receiving them right away
+	receiveHandler func(b byte)
+
+	receiveMutex  *sync.Mutex
+	receiveBuffer []byte
+
+	interrupts *bus.InterruptLines
 }
 
 func NewI8251() *I8251 {
-	return &I8251{
-		reader: bufio.NewReader(os.Stdin),
+	newDevice := &I8251{
+		reader:       bufio.NewReader(os.Stdin),
+		receiveMutex: &sync.Mutex{},
+	}
+	go newDevice.receiveLoop()
+	return newDevice
+}
+
+// ConnectInterrupt wires RxRDY to /INT, like on the next board revision
+func (u *I8251) ConnectInterrupt(interrupts *bus.InterruptLines) {
+	u.receiveMutex.Lock()
+	u.interrupts = interrupts
+	u.receiveMutex.Unlock()
+}
+
+// SetReceiveHandler sends bytes from stdin to handler, which should pass them to Receive when it's ready for them
+func (u *I8251) SetReceiveHandler(handler func(b byte)) {
+	u.receiveMutex.Lock()
+	u.receiveHandler = handler
+	u.receiveMutex.Unlock()
+}
+
+func (u *I8251) receiveLoop() {
+	for {
+		b, err := u.reader.ReadByte()
+		if err != nil {
+			return
+		}
+
+		u.receiveMutex.Lock()
+		handler := u.receiveHandler
+		u.receiveMutex.Unlock()
+
+		if handler != nil {
+			handler(b)
+		} else {
+			u.Receive(b)
+		}
 	}
 }
 
+// Receive puts a byte in the receive buffer, as if it came in over the serial line
+func (u *I8251) Receive(b byte) {
+	u.receiveMutex.Lock()
+	u.receiveBuffer = append(u.receiveBuffer, b)
+	if u.interrupts != nil {
+		u.interrupts.Assert(u, 0xFF)
+	}
+	u.receiveMutex.Unlock()
+}
+
 func (u *I8251) IsMapped(address uint16) bool {
 	if (address&(1<<15) == 0) && (address&(1<<14) != 0) && (address&(1<<13) == 0) && (address&(1<<12) == 0) {
 		return true
@@ -27,20 +86,31 @@ func (u *I8251) ReadByte(address uint16) uint8 {
 	maskedAddress := address & 1
 	if maskedAddress == 0 {
 		// data
-		b, _ := u.reader.ReadByte()
+		u.receiveMutex.Lock()
+		defer u.receiveMutex.Unlock()
+		if len(u.receiveBuffer) == 0 {
+			return 0
+		}
+		b := u.receiveBuffer[0]
+		u.receiveBuffer = u.receiveBuffer[1:]
+		if len(u.receiveBuffer) == 0 && u.interrupts != nil {
+			u.interrupts.Deassert(u)
+		}
 		return b
 	} else {
 		// control/status
 		flags := uint8(0)
-		if u.reader.Buffered() > 0 {
-			flags |= (1 << 1)
+		u.receiveMutex.Lock()
+		if len(u.receiveBuffer) > 0 {
+			flags |= (1 << 1) // rxrdy
 		}
+		u.receiveMutex.Unlock()
 		flags |= (1 << 2) // txempty
 		return flags
 	}
 }
 
-func (u *I8251) WriteByte(address uint16, data uint8) {
+func (u *I8251) WriteByte(address uint16, data uint8) error {
 	maskedAddress := address & 1
 	if maskedAddress == 0 {
 		// data
@@ -48,4 +118,44 @@ func (u *I8251) WriteByte(address uint16, data uint8) {
 	} else {
 		// control/status
 	}
+	return nil
+}
+
+// SaveState writes the bytes that have been received but not read yet
+func (u *I8251) SaveState(w io.Writer) error {
+	u.receiveMutex.Lock()
+	defer u.receiveMutex.Unlock()
+
+	err := binary.Write(w, binary.LittleEndian, uint32(len(u.receiveBuffer)))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(u.receiveBuffer)
+	return err
+}
+
+func (u *I8251) LoadState(r io.Reader) error {
+	length := uint32(0)
+	err := binary.Read(r, binary.LittleEndian, &length)
+	if err != nil {
+		return err
+	}
+	receiveBuffer := make([]byte, length)
+	_, err = io.ReadFull(r, receiveBuffer)
+	if err != nil {
+		return err
+	}
+
+	u.receiveMutex.Lock()
+	defer u.receiveMutex.Unlock()
+	u.receiveBuffer = receiveBuffer
+	if u.interrupts != nil {
+		// rxrdy follows the buffer
+		if len(u.receiveBuffer) > 0 {
+			u.interrupts.Assert(u, 0xFF)
+		} else {
+			u.interrupts.Deassert(u)
+		}
+	}
+	return nil
 }
@@ -1,7 +1,8 @@
 package devices
 
 import (
-	"errors"
+	"encoding/binary"
+	"io"
 )
 
 // Port A: input
@@ -24,6 +25,17 @@ type I8255 struct {
 	portCLowInput  bool
 }
 
+// port latches and directions, laid out for encoding/binary
+type i8255State struct {
+	PortA          uint8
+	PortB          uint8
+	PortC          uint8
+	PortAInput     bool
+	PortBInput     bool
+	PortCHighInput bool
+	PortCLowInput  bool
+}
+
 func NewI8255() *I8255 {
 	return &I8255{
 		portAInput:     true,
@@ -72,7 +84,7 @@ func (p *I8255) ReadByte(address uint16) uint8 {
 	return 0xFF // illegal condition
 }
 
-func (p *I8255) WriteByte(address uint16, data uint8) {
+func (p *I8255) WriteByte(address uint16, data uint8) error {
 	maskedAddress := address & 3
 	if maskedAddress == 0 {
 		p.portA = data
@@ -93,7 +105,7 @@ func (p *I8255) WriteByte(address uint16, data uint8) {
 			portCLowDirection := data & 1
 
 			if portAMode != 0 || portBMode != 0 {
-				panic(errors.New("non-zero modes not implemented"))
+				return ErrModeNotImplemented
 			}
 
 			p.portAInput = (portADirection == 1)
@@ -110,4 +122,34 @@ func (p *I8255) WriteByte(address uint16, data uint8) {
 			}
 		}
 	}
+	return nil
+}
+
+func (p *I8255) SaveState(w io.Writer) error {
+	return binary.Write(w, binary.LittleEndian, &i8255State{
+		PortA:          p.portA,
+		PortB:          p.portB,
+		PortC:          p.portC,
+		PortAInput:     p.portAInput,
+		PortBInput:     p.portBInput,
+		PortCHighInput: p.portCHighInput,
+		PortCLowInput:  p.portCLowInput,
+	})
+}
+
+func (p *I8255) LoadState(r io.Reader) error {
+	state := i8255State{}
+	err := binary.Read(r, binary.LittleEndian, &state)
+	if err != nil {
+		return err
+	}
+
+	p.portA = state.PortA
+	p.portB = state.PortB
+	p.portC = state.PortC
+	p.portAInput = state.PortAInput
+	p.portBInput = state.PortBInput
+	p.portCHighInput = state.PortCHighInput
+	p.portCLowInput = state.PortCLowInput
+	return nil
 }
@@ -1,5 +1,9 @@
 package devices
 
+import (
+	"io"
+)
+
 type KR537RU2 struct {
 	RAM [4 * 1024]byte
 }
@@ -21,7 +25,28 @@ func (r *KR537RU2) ReadByte(address uint16) uint8 {
 	return r.RAM[accessAddress]
 }
 
-func (r *KR537RU2) WriteByte(address uint16, data uint8) {
+// reading doesn't change anything, so this is the same as ReadByte
+func (r *KR537RU2) PeekByte(address uint16) uint8 {
+	return r.ReadByte(address)
+}
+
+// nothing stops anything writing to ram, so this is the same as WriteByte
+func (r *KR537RU2) PokeByte(address uint16, data uint8) error {
+	return r.WriteByte(address, data)
+}
+
+func (r *KR537RU2) WriteByte(address uint16, data uint8) error {
 	accessAddress := address & 0x0FFF
 	r.RAM[accessAddress] = data
+	return nil
+}
+
+func (r *KR537RU2) SaveState(w io.Writer) error {
+	_, err := w.Write(r.RAM[:])
+	return err
+}
+
+func (r *KR537RU2) LoadState(rd io.Reader) error {
+	_, err := io.ReadFull(rd, r.RAM[:])
+	return err
 }
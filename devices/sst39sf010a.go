@@ -1,18 +1,23 @@
 package devices
 
 import (
-	"errors"
+	"encoding/binary"
+	"io"
+	"time"
 )
 
 // in the rom0 slot
 
 type SST39SF010A struct {
+	Timing
+
 	ROM      [128 * 1024]byte
 	ReadOnly bool
 }
 
 func NewSST39SF010A() *SST39SF010A {
 	return &SST39SF010A{
+		Timing:   Timing{Access: 70 * time.Nanosecond},
 		ReadOnly: true,
 	}
 }
@@ -40,9 +45,23 @@ func (r *SST39SF010A) ReadByte(address uint16) uint8 {
 	return r.ROM[accessAddress]
 }
 
-func (r *SST39SF010A) WriteByte(address uint16, data uint8) {
+// reading doesn't change anything, so this is the same as ReadByte
+func (r *SST39SF010A) PeekByte(address uint16) uint8 {
+	return r.ReadByte(address)
+}
+
+// flash can be reprogrammed, so this writes to it even when it's read only to the cpu
+func (r *SST39SF010A) PokeByte(address uint16, data uint8) error {
+	readOnly := r.ReadOnly
+	r.ReadOnly = false
+	err := r.WriteByte(address, data)
+	r.ReadOnly = readOnly
+	return err
+}
+
+func (r *SST39SF010A) WriteByte(address uint16, data uint8) error {
 	if r.ReadOnly {
-		panic(errors.New("sst39sf010a: write to ROM"))
+		return ErrWriteToROM
 	}
 
 	accessAddress := address & 0x0FFF
@@ -57,4 +76,22 @@ func (r *SST39SF010A) WriteByte(address uint16, data uint8) {
 	}
 
 	r.ROM[accessAddress] = data
+	return nil
+}
+
+// the contents are saved too, since they can be written to
+func (r *SST39SF010A) SaveState(w io.Writer) error {
+	_, err := w.Write(r.ROM[:])
+	if err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, r.ReadOnly)
+}
+
+func (r *SST39SF010A) LoadState(rd io.Reader) error {
+	_, err := io.ReadFull(rd, r.ROM[:])
+	if err != nil {
+		return err
+	}
+	return binary.Read(rd, binary.LittleEndian, &r.ReadOnly)
 }
@@ -1,6 +1,8 @@
 package devices
 
 import (
+	"encoding/binary"
+	"io"
 	"sync"
 	"time"
 
@@ -18,6 +20,13 @@ const (
 type ST7565P struct {
 	PausedForBreakpoint bool
 
+	// called with keys released in the display window that aren't buttons, like the save state hotkeys
+	HotkeyHandler func(key sdl.Keycode)
+
+	// called with the new state of the buttons when one's pressed or released, instead of setting the PIO's port A directly
+	ButtonHandler func(buttons uint8)
+	buttons       uint8
+
 	columnImmediatelySet bool
 	columnAddress        uint8
 	pageAddress          uint8
@@ -34,6 +43,16 @@ type ST7565P struct {
 	sdlSurface *sdl.Surface
 }
 
+// controller registers and display ram, laid out for encoding/binary
+type st7565pState struct {
+	ColumnImmediatelySet bool
+	ColumnAddress        uint8
+	PageAddress          uint8
+	ReadModifyWrite      bool
+	DisplayRAM           [st7565p_page_width * (st7565p_page_count + 1)]byte
+	DisplayInvert        bool
+}
+
 func NewST7565P(pio *I8255) *ST7565P {
 	newDevice := &ST7565P{
 		displayMutex: &sync.Mutex{},
@@ -126,10 +145,18 @@ func (d *ST7565P) drawLoop() {
 					}
 					if wasButtonEvent {
 						if e.State == sdl.PRESSED {
-							d.pio.SetPortA(d.pio.GetPortA() | (1 << buttonBit))
+							d.buttons |= (1 << buttonBit)
 						} else if e.State == sdl.RELEASED {
-							d.pio.SetPortA(d.pio.GetPortA() & ^(1 << buttonBit))
+							d.buttons &= ^(1 << buttonBit)
 						}
+						if d.ButtonHandler != nil {
+							d.ButtonHandler(d.buttons)
+						} else {
+							d.pio.SetPortA(d.buttons)
+						}
+					} else if e.State == sdl.RELEASED && d.HotkeyHandler != nil {
+						// the handler might have to wait for the cpu, so don't hold up the event loop
+						go d.HotkeyHandler(e.Keysym.Sym)
 					}
 				}
 			}
@@ -219,7 +246,7 @@ func (d *ST7565P) ReadByte(address uint16) uint8 {
 	}
 }
 
-func (d *ST7565P) WriteByte(address uint16, data uint8) {
+func (d *ST7565P) WriteByte(address uint16, data uint8) error {
 	maskedAddress := address & 0x800
 	if maskedAddress == 0 {
 		// command
@@ -314,4 +341,40 @@ func (d *ST7565P) WriteByte(address uint16, data uint8) {
 		d.displayMutex.Unlock()
 		d.incrementColumn()
 	}
+	return nil
+}
+
+func (d *ST7565P) SaveState(w io.Writer) error {
+	d.displayMutex.Lock()
+	state := st7565pState{
+		ColumnImmediatelySet: d.columnImmediatelySet,
+		ColumnAddress:        d.columnAddress,
+		PageAddress:          d.pageAddress,
+		ReadModifyWrite:      d.readModifyWrite,
+		DisplayRAM:           d.displayRAM,
+		DisplayInvert:        d.displayInvert,
+	}
+	d.displayMutex.Unlock()
+
+	return binary.Write(w, binary.LittleEndian, &state)
+}
+
+func (d *ST7565P) LoadState(r io.Reader) error {
+	state := st7565pState{}
+	err := binary.Read(r, binary.LittleEndian, &state)
+	if err != nil {
+		return err
+	}
+
+	d.columnImmediatelySet = state.ColumnImmediatelySet
+	d.columnAddress = state.ColumnAddress
+	d.pageAddress = state.PageAddress
+	d.readModifyWrite = state.ReadModifyWrite
+
+	d.displayMutex.Lock()
+	d.displayRAM = state.DisplayRAM
+	d.displayInvert = state.DisplayInvert
+	d.displayDirty = true
+	d.displayMutex.Unlock()
+	return nil
 }
@@ -0,0 +1,19 @@
+package devices
+
+import (
+	"time"
+)
+
+// Timing describes how quickly a memory chip responds, and how many wait states the board's /WAIT circuitry adds for it
+type Timing struct {
+	Access time.Duration
+	Wait   int
+}
+
+func (t *Timing) AccessTime() time.Duration {
+	return t.Access
+}
+
+func (t *Timing) WaitStates() int {
+	return t.Wait
+}
@@ -0,0 +1,232 @@
+// Package disassembler turns a ROM image back into source that assembles to the same bytes, by following the code from its entry points.
+package disassembler
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/thatoddmailbox/computer-emu/cpu"
+)
+
+// data bytes are written this many to a line
+const dataBytesPerLine = 8
+
+// the rst instructions' targets
+var rstVectors = []uint16{0x0008, 0x0010, 0x0018, 0x0020, 0x0028, 0x0030, 0x0038}
+
+// Disassembler separates a ROM image into code and data, starting from entry points and following every jump and call it finds.
+type Disassembler struct {
+	// the address the image starts at, as the cpu sees it
+	Base uint16
+	Code []byte
+
+	// the instructions that were found, by address
+	instructions map[uint16]cpu.Instruction
+
+	// whether each byte of Code is part of an instruction
+	claimed []bool
+
+	labels map[uint16]string
+}
+
+func NewDisassembler(code []byte, base uint16) *Disassembler {
+	if len(code) > 0x10000-int(base) {
+		// the rest wouldn't be visible to the cpu
+		code = code[:0x10000-int(base)]
+	}
+	return &Disassembler{
+		Base:         base,
+		Code:         code,
+		instructions: map[uint16]cpu.Instruction{},
+		claimed:      make([]bool, len(code)),
+		labels:       map[uint16]string{},
+	}
+}
+
+func (d *Disassembler) contains(address uint16) bool {
+	return address >= d.Base && int(address-d.Base) < len(d.Code)
+}
+
+// label names address, unless it already has a better name. Entry points keep theirs, and subroutines beat plain jump targets.
+func (d *Disassembler) label(address uint16, name string) {
+	existing, exists := d.labels[address]
+	if !exists || (strings.HasPrefix(existing, "loc_") && strings.HasPrefix(name, "sub_")) {
+		d.labels[address] = name
+	}
+}
+
+// endsFlow returns whether the instruction after this one only runs if something jumps to it
+func endsFlow(instruction cpu.Instruction) bool {
+	switch instruction.Mnemonic {
+	case "jp", "jr", "ret":
+		return !instruction.Conditional()
+	case "reti", "retn":
+		return true
+	}
+	return false
+}
+
+// Trace disassembles the code at entry, and everything it jumps to or calls, giving entry the given label.
+// It stops at anything that isn't an instruction, or that overlaps an instruction it already found.
+func (d *Disassembler) Trace(entry uint16, name string) {
+	if !d.contains(entry) {
+		return
+	}
+	d.label(entry, name)
+
+	pending := []uint16{entry}
+	for len(pending) > 0 {
+		address := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		for d.contains(address) {
+			offset := int(address - d.Base)
+			if d.claimed[offset] {
+				// already found, or the middle of something that was
+				break
+			}
+
+			instruction, err := cpu.Disassemble(d.Code[offset:], address)
+			if err != nil || !instruction.Known() {
+				break
+			}
+			overlaps := false
+			for i := range instruction.Bytes {
+				if d.claimed[offset+i] {
+					overlaps = true
+				}
+			}
+			if overlaps {
+				break
+			}
+
+			for i := range instruction.Bytes {
+				d.claimed[offset+i] = true
+			}
+			d.instructions[address] = instruction
+
+			target, ok := instruction.Target()
+			if ok && d.contains(target) {
+				if instruction.Mnemonic == "call" || instruction.Mnemonic == "rst" {
+					d.label(target, fmt.Sprintf("sub_%04X", target))
+				} else {
+					d.label(target, fmt.Sprintf("loc_%04X", target))
+				}
+				pending = append(pending, target)
+			}
+
+			if endsFlow(instruction) || int(address)+len(instruction.Bytes) > 0xFFFF {
+				break
+			}
+			address += instruction.Length()
+		}
+	}
+}
+
+// TraceVectors disassembles from the reset vector, then from each rst vector that isn't already part of something else.
+func (d *Disassembler) TraceVectors() {
+	d.Trace(0x0000, "reset")
+	for _, vector := range rstVectors {
+		if d.contains(vector) && !d.claimed[int(vector-d.Base)] {
+			d.Trace(vector, fmt.Sprintf("rst_%02X", vector))
+		}
+	}
+}
+
+// labelAt returns the label at address, if it's at the start of an instruction, since that's the only place one can be written
+func (d *Disassembler) labelAt(address uint16) (string, bool) {
+	if _, ok := d.instructions[address]; !ok {
+		return "", false
+	}
+	name, ok := d.labels[address]
+	return name, ok
+}
+
+func (d *Disassembler) formatInstruction(instruction cpu.Instruction) string {
+	operands := []string{}
+	for _, operand := range instruction.Operands {
+		text := operand.Format(nil)
+		if operand.Type == cpu.OperandAddress || operand.Type == cpu.OperandRelative {
+			name, ok := d.labelAt(operand.Value)
+			if ok {
+				text = name
+			}
+		}
+		operands = append(operands, text)
+	}
+	if len(operands) == 0 {
+		return instruction.Mnemonic
+	}
+	return instruction.Mnemonic + " " + strings.Join(operands, ", ")
+}
+
+func formatData(data []byte) string {
+	values := []string{}
+	for _, value := range data {
+		values = append(values, fmt.Sprintf("0x%02x", value))
+	}
+	return ".db " + strings.Join(values, ", ")
+}
+
+// Counts returns how many instructions were found, and how many bytes they take up.
+func (d *Disassembler) Counts() (int, int) {
+	code := 0
+	for _, claimed := range d.claimed {
+		if claimed {
+			code += 1
+		}
+	}
+	return len(d.instructions), code
+}
+
+// Write writes the disassembly as source for z80asm. Instructions that an assembler might encode differently, like undocumented ones, are written as .db with the instruction in a comment.
+func (d *Disassembler) Write(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "\t.org 0x%04x\n", d.Base)
+	if err != nil {
+		return err
+	}
+
+	offset := 0
+	for offset < len(d.Code) {
+		address := d.Base + uint16(offset)
+
+		instruction, isInstruction := d.instructions[address]
+		if isInstruction {
+			name, ok := d.labelAt(address)
+			if ok {
+				_, err = fmt.Fprintf(w, "\n%s:\n", name)
+				if err != nil {
+					return err
+				}
+			}
+
+			text := d.formatInstruction(instruction)
+			comment := fmt.Sprintf("%04X: % X", address, instruction.Bytes)
+			if instruction.Undocumented || !instruction.Canonical() {
+				comment += " (" + text + ")"
+				text = formatData(instruction.Bytes)
+			}
+			_, err = fmt.Fprintf(w, "\t%-32s ; %s\n", text, comment)
+			if err != nil {
+				return err
+			}
+
+			offset += len(instruction.Bytes)
+			continue
+		}
+
+		// everything up to the next instruction is data
+		length := 1
+		for length < dataBytesPerLine && offset+length < len(d.Code) && !d.claimed[offset+length] {
+			length += 1
+		}
+		_, err = fmt.Fprintf(w, "\t%-32s ; %04X\n", formatData(d.Code[offset:offset+length]), address)
+		if err != nil {
+			return err
+		}
+		offset += length
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package disassembler
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/thatoddmailbox/computer-emu/cpu"
+	"github.com/thatoddmailbox/computer-emu/symbols"
+)
+
+// reassemble assembles the output of Write back into bytes, using the addresses in the comments to find where the labels are
+func reassemble(t *testing.T, source string) []byte {
+	lines := []string{}
+	scanner := bufio.NewScanner(strings.NewReader(source))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	table := &symbols.Table{Start: 0x0000, End: 0xFFFF}
+	pending := []string{}
+	for _, line := range lines {
+		text := strings.TrimSpace(line)
+		if strings.HasSuffix(text, ":") {
+			pending = append(pending, strings.TrimSuffix(text, ":"))
+			continue
+		}
+		comment := strings.Index(line, "; ")
+		if comment == -1 {
+			continue
+		}
+		address, err := strconv.ParseUint(strings.TrimSuffix(strings.Fields(line[comment+2:])[0], ":"), 16, 16)
+		if err != nil {
+			t.Fatalf("no address in %q", line)
+		}
+		for _, name := range pending {
+			table.Symbols = append(table.Symbols, symbols.Symbol{Name: name, Address: uint16(address)})
+		}
+		pending = nil
+	}
+	s := &symbols.Symbols{}
+	s.Add(table)
+
+	assembled := []byte{}
+	address := uint16(0)
+	for _, line := range lines {
+		if comment := strings.Index(line, ";"); comment != -1 {
+			line = line[:comment]
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasSuffix(line, ":"):
+		case strings.HasPrefix(line, ".org "):
+			org, err := strconv.ParseUint(strings.TrimPrefix(line, ".org 0x"), 16, 16)
+			if err != nil {
+				t.Fatal(err)
+			}
+			address = uint16(org)
+		case strings.HasPrefix(line, ".db "):
+			for _, value := range strings.Split(strings.TrimPrefix(line, ".db "), ",") {
+				data, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(value), "0x"), 16, 8)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assembled = append(assembled, uint8(data))
+				address += 1
+			}
+		default:
+			instruction, err := cpu.Assemble(line, address, s)
+			if err != nil {
+				t.Fatalf("%s: %v", line, err)
+			}
+			assembled = append(assembled, instruction...)
+			address += uint16(len(instruction))
+		}
+	}
+	return assembled
+}
+
+func TestReassemble(t *testing.T) {
+	rom := []byte{
+		0x21, 0x34, 0x12, // 0000: ld hl, 0x1234
+		0x22, 0x00, 0x80, // 0003: ld (0x8000), hl
+		0xED, 0x63, 0x02, 0x80, // 0006: ld (0x8002), hl, which an assembler wouldn't pick
+		0xCD, 0x12, 0x00, // 000A: call 0x0012
+		0x20, 0xF1, // 000D: jr nz, 0x0000
+		0x18, 0xFE, // 000F: jr 0x000F
+		0xAA,       // 0011: data
+		0xCB, 0x30, // 0012: sll b, which is undocumented
+		0xDD, 0x7E, 0xFB, // 0014: ld a, (ix-5)
+		0xC9,       // 0017: ret
+		0x12, 0x34, // 0018: data
+	}
+
+	d := NewDisassembler(rom, 0x0000)
+	d.TraceVectors()
+	output := &bytes.Buffer{}
+	err := d.Write(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"ld [0x8000], hl", "call sub_0012", "jr nz, reset", ".db 0xed, 0x63, 0x02, 0x80", ".db 0xcb, 0x30"} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("output doesn't have %q:\n%s", expected, output.String())
+		}
+	}
+
+	reassembled := reassemble(t, output.String())
+	if !bytes.Equal(reassembled, rom) {
+		t.Errorf("reassembled to % X, expected % X:\n%s", reassembled, rom, output.String())
+	}
+}
@@ -2,22 +2,41 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/thatoddmailbox/computer-emu/bus"
+	"github.com/thatoddmailbox/computer-emu/coverage"
+	"github.com/thatoddmailbox/computer-emu/cpm"
 	"github.com/thatoddmailbox/computer-emu/cpu"
 	"github.com/thatoddmailbox/computer-emu/debugger"
 	"github.com/thatoddmailbox/computer-emu/devices"
+	"github.com/thatoddmailbox/computer-emu/disassembler"
+	"github.com/thatoddmailbox/computer-emu/profiler"
+	"github.com/thatoddmailbox/computer-emu/replay"
+	"github.com/thatoddmailbox/computer-emu/rewind"
+	"github.com/thatoddmailbox/computer-emu/savestate"
+	"github.com/thatoddmailbox/computer-emu/symbols"
+	"github.com/thatoddmailbox/computer-emu/trace"
+
+	"github.com/veandco/go-sdl2/sdl"
 )
 
 var st7565p *devices.ST7565P
 
+// how far back Backspace goes
+const rewindSeconds = 5
+
 func loadHexFile(path string, rom *devices.I2716) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -56,22 +75,379 @@ func loadBinFile(path string, rom []byte) {
 	file.Read(rom)
 }
 
+func parseAddress(text string) uint16 {
+	address, err := strconv.ParseUint(strings.TrimPrefix(text, "0x"), 16, 16)
+	if err != nil {
+		log.Fatalf("Invalid address '%s'", text)
+	}
+	return uint16(address)
+}
+
+func parseAddressRange(text string) (uint16, uint16) {
+	parts := strings.Split(text, "-")
+	if len(parts) != 2 {
+		log.Fatalf("Invalid address range '%s'", text)
+	}
+	return parseAddress(parts[0]), parseAddress(parts[1])
+}
+
+// splitSymbolFile splits something like bank1.sym@1000-1FFF into the path and the range it applies to, which is all of memory if it isn't given
+func splitSymbolFile(text string) (string, uint16, uint16) {
+	parts := strings.SplitN(text, "@", 2)
+	if len(parts) == 1 {
+		return text, 0x0000, 0xFFFF
+	}
+	start, end := parseAddressRange(parts[1])
+	return parts[0], start, end
+}
+
+func createTracer(path string, format string, addressRange string, subroutine string, fromBreakpoint bool) *trace.Tracer {
+	formatType := trace.FormatText
+	if format == "binary" {
+		formatType = trace.FormatBinary
+	} else if format != "text" {
+		log.Fatalf("Unknown trace format '%s'", format)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tracer, err := trace.NewTracer(file, formatType)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if addressRange != "" {
+		tracer.Start, tracer.End = parseAddressRange(addressRange)
+	}
+	if subroutine != "" {
+		address := parseAddress(subroutine)
+		tracer.Subroutine = &address
+	}
+	tracer.FromBreakpoint = fromBreakpoint
+
+	return tracer
+}
+
+func readRecording(path string) *replay.Recording {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	recording, err := replay.ReadRecording(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return recording
+}
+
+func writeProfile(profile *profiler.Profiler, path string, reportPath string) {
+	if path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			log.Println(err)
+		} else {
+			err = profile.WriteProfile(file)
+			file.Close()
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}
+
+	if reportPath != "" {
+		file, err := os.Create(reportPath)
+		if err != nil {
+			log.Println(err)
+		} else {
+			err = profile.WriteReport(file)
+			file.Close()
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+// loadListings loads each listing, along with a table of its labels for the range it applies to
+func loadListings(paths string) ([]*symbols.Listing, []*symbols.Table) {
+	listings := []*symbols.Listing{}
+	tables := []*symbols.Table{}
+	if paths == "" {
+		return listings, tables
+	}
+	for _, text := range strings.Split(paths, ",") {
+		path, start, end := splitSymbolFile(text)
+		listing, err := symbols.LoadListing(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		listings = append(listings, listing)
+
+		table := listing.Table()
+		table.Start = start
+		table.End = end
+		tables = append(tables, table)
+	}
+	return listings, tables
+}
+
+// loadSymbols loads each symbol file, and adds them to the tables from the listings, or returns nil if there aren't any
+func loadSymbols(paths string, listingTables []*symbols.Table) *symbols.Symbols {
+	tables := listingTables
+	if paths != "" {
+		for _, text := range strings.Split(paths, ",") {
+			path, start, end := splitSymbolFile(text)
+			table, err := symbols.LoadTable(path)
+			if err != nil {
+				log.Fatal(err)
+			}
+			table.Start = start
+			table.End = end
+			tables = append(tables, table)
+		}
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+
+	loadedSymbols := &symbols.Symbols{}
+	for _, table := range tables {
+		loadedSymbols.Add(table)
+	}
+	return loadedSymbols
+}
+
+func writeCoverage(romCoverage *coverage.Coverage, listings []*symbols.Listing, listingPath string, lcovPath string, coberturaPath string) {
+	reports := []struct {
+		path  string
+		write func(w io.Writer) error
+	}{
+		{listingPath, romCoverage.WriteListing},
+		{lcovPath, func(w io.Writer) error { return romCoverage.WriteLCOV(w, listings) }},
+		{coberturaPath, func(w io.Writer) error { return romCoverage.WriteCobertura(w, listings) }},
+	}
+	for _, report := range reports {
+		if report.path == "" {
+			continue
+		}
+		file, err := os.Create(report.path)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		err = report.write(file)
+		file.Close()
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func parseCPUVariant(name string) cpu.CPUVariantType {
+	switch name {
+	case "z80":
+		return cpu.CPUVariantZ80
+	case "8080", "kr580vm80a":
+		return cpu.CPUVariant8080
+	default:
+		log.Fatalf("Unknown CPU variant '%s'", name)
+		return cpu.CPUVariantZ80
+	}
+}
+
+func runCPMProgram(path string, variant cpu.CPUVariantType, strict bool) {
+	program, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	machine, err := cpm.NewMachine(program, os.Stdout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	machine.CPU.Variant = variant
+	machine.CPU.Strict = strict
+
+	start := time.Now()
+	err = machine.Run()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Program finished after %d T-states (%s)", machine.CPU.Cycles, time.Since(start))
+}
+
+// romImage returns what the cpu sees of the rom in path, when it's in the slot at base
+func romImage(path string, base uint16, weirdMapping bool) []byte {
+	if !weirdMapping {
+		image, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return image
+	}
+
+	// the modern roms only show 4K of themselves, with their address lines rearranged
+	var rom bus.BusMemoryIODevice
+	if base == 0x0000 {
+		flash := devices.NewSST39SF010A()
+		loadBinFile(path, flash.ROM[:])
+		rom = flash
+	} else if base == 0x1000 {
+		eeprom := devices.NewAT28C256()
+		loadBinFile(path, eeprom.ROM[:])
+		rom = eeprom
+	} else {
+		log.Fatalf("With --weird-mapping, the base has to be 0x0000 (ROM0) or 0x1000 (ROM1), not 0x%04X", base)
+	}
+	image := make([]byte, 0x1000)
+	for i := range image {
+		image[i] = rom.ReadByte(base + uint16(i))
+	}
+	return image
+}
+
+// runDisassembler handles the disasm command, which disassembles a rom into source that assembles back to the same bytes
+func runDisassembler(args []string) {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	base := flags.String("base", "0x0000", "The address the ROM starts at.")
+	weirdMapping := flags.Bool("weird-mapping", false, "Disassembles what the CPU sees of an SST39SF010A (with --base 0x0000) or an AT28C256 (with --base 0x1000) in the weird mapping.")
+	entries := flags.String("entry", "", "More addresses that code starts at, separated by commas, like interrupt handlers that are only reached through a table.")
+	output := flags.String("output", "", "The file to write the disassembly to, instead of standard output.")
+
+	// the rom can come before or after the flags
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		log.Fatal("Usage: computer-emu disasm rom.bin [--base 0x0000] [--weird-mapping] [--entry 0x0100,...] [--output rom.asm]")
+	}
+	path := flags.Arg(0)
+	flags.Parse(flags.Args()[1:])
+
+	baseAddress := parseAddress(*base)
+	d := disassembler.NewDisassembler(romImage(path, baseAddress, *weirdMapping), baseAddress)
+	d.TraceVectors()
+	if *entries != "" {
+		for _, entry := range strings.Split(*entries, ",") {
+			address := parseAddress(entry)
+			d.Trace(address, fmt.Sprintf("entry_%04X", address))
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	writer := bufio.NewWriter(w)
+	err := d.Write(writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	instructions, codeBytes := d.Counts()
+	log.Printf("Found %d instructions, taking up %d of %d bytes", instructions, codeBytes, len(d.Code))
+}
+
 func main() {
-	log.Println("computer-emu")
+	if len(os.Args) > 1 && os.Args[1] == "disasm" {
+		runDisassembler(os.Args[2:])
+		return
+	}
 
-	rand.Seed(time.Now().UTC().UnixNano())
+	log.Println("computer-emu")
 
 	weirdMapping := flag.Bool("weird-mapping", false, "Enables the weird mapping, with two modern ROMs in ROM0 and ROM1, and a modern RAM chip in ROM3.")
 	randomRam := flag.Bool("random-ram", false, "Fills the RAM with random data.")
+	clockSpeed := flag.Int("clock-speed", 4000000, "The CPU clock speed, in Hz.")
+	serialInterrupt := flag.Bool("serial-interrupt", false, "Wires the I8251's RxRDY line to /INT, like on the next board revision.")
+	cpmProgram := flag.String("cpm", "", "Runs the given CP/M .COM program without a display, instead of the computer.")
+	cpuVariant := flag.String("cpu", "z80", "The CPU to emulate, either z80 or 8080. (kr580vm80a is the same as 8080)")
+	strictCPU := flag.Bool("strict-cpu", false, "Stops in the debugger before running undocumented instructions.")
+	stateFile := flag.String("state-file", "state.sav", "The file that the save state hotkeys (F5 to save, F9 to load) use.")
+	loadState := flag.String("load-state", "", "Loads the given save state at startup.")
+	rewindBudget := flag.Int("rewind-budget", 256, "The most memory, in MB, used to keep the history for stepping back in the debugger and rewinding with Backspace. 0 turns it off.")
+	traceFile := flag.String("trace", "", "Writes a trace of every instruction to the given file.")
+	traceFormat := flag.String("trace-format", "text", "The trace format, either text or binary.")
+	traceRange := flag.String("trace-range", "", "Only traces instructions in the given range of addresses, like 0000-0FFF.")
+	traceSubroutine := flag.String("trace-subroutine", "", "Only traces the subroutine at the given address, from when it's called until it returns.")
+	traceFromBreakpoint := flag.Bool("trace-from-breakpoint", false, "Waits until a breakpoint is hit before tracing.")
+	seed := flag.Int64("seed", 0, "Seeds the random number generator used for --random-ram. 0 picks one from the time.")
+	recordInput := flag.String("record-input", "", "Records the buttons and serial input, along with the seed, to the given file.")
+	replayInput := flag.String("replay-input", "", "Replays the buttons, serial input, and seed recorded in the given file.")
+	profileFile := flag.String("profile", "", "Profiles the firmware, writing a pprof profile to the given file on exit. (see go tool pprof)")
+	profileReport := flag.String("profile-report", "", "Profiles the firmware, writing a text report of the time spent in each subroutine to the given file on exit.")
+	coverageListing := flag.String("coverage-listing", "", "Measures ROM coverage, writing a disassembly marked with what ran, what was read as data, and what was never touched to the given file on exit.")
+	coverageLCOV := flag.String("coverage-lcov", "", "Measures ROM coverage, writing it in the lcov format to the given file on exit. Needs --listing.")
+	coverageCobertura := flag.String("coverage-cobertura", "", "Measures ROM coverage, writing it as Cobertura XML to the given file on exit. Needs --listing.")
+	listingFiles := flag.String("listing", "", "The assembler listings of the firmware, separated by commas, which lcov and Cobertura coverage is reported against. Their labels are used like --symbols.")
+	symbolFiles := flag.String("symbols", "", "The assembler's symbol files, separated by commas, used to show addresses as labels. A file can be limited to one ROM bank's addresses with @, like bank1.sym@1000-1FFF.")
+	romWaitStates := flag.Int("rom-wait-states", 0, "The number of wait states added to each ROM access, for trying out /WAIT circuitry.")
 
 	flag.Parse()
 
-	bus := bus.EmulatorBus{}
+	if *clockSpeed <= 0 {
+		log.Fatalf("Invalid clock speed %d, it has to be a positive number of Hz", *clockSpeed)
+	}
+
+	variant := parseCPUVariant(*cpuVariant)
+
+	var recording *replay.Recording
+	if *replayInput != "" {
+		recording = readRecording(*replayInput)
+		*seed = recording.Seed
+	}
+	if *seed == 0 {
+		*seed = time.Now().UTC().UnixNano()
+	}
+	rand.Seed(*seed)
+
+	if *cpmProgram != "" {
+		runCPMProgram(*cpmProgram, variant, *strictCPU)
+		return
+	}
+
+	listings, listingTables := loadListings(*listingFiles)
+	loadedSymbols := loadSymbols(*symbolFiles, listingTables)
+	if (*coverageLCOV != "" || *coverageCobertura != "") && len(listings) == 0 {
+		log.Fatal("--coverage-lcov and --coverage-cobertura need --listing")
+	}
+	measureCoverage := *coverageListing != "" || *coverageLCOV != "" || *coverageCobertura != ""
+	var romCoverage *coverage.Coverage
+	romDevices := []bus.BusMemoryIODevice{}
+
+	bus := bus.EmulatorBus{
+		Interrupts: bus.NewInterruptLines(),
+	}
 
 	sim := cpu.CPU{}
+	sim.Variant = variant
 	sim.Bus = bus
+	sim.Symbols = loadedSymbols
 	cpuMutex := sync.Mutex{}
 
+	var profile *profiler.Profiler
+	if *profileFile != "" || *profileReport != "" {
+		profile = profiler.NewProfiler(&sim)
+	}
+
+	var inputs *replay.Inputs
+	var tracer *trace.Tracer
+	if *traceFile != "" {
+		tracer = createTracer(*traceFile, *traceFormat, *traceRange, *traceSubroutine, *traceFromBreakpoint)
+	}
+
 	dbg := debugger.NewDebugger(&sim, &cpuMutex, func() {
 		log.Println("Execution resumed!")
 		st7565p.PausedForBreakpoint = false
@@ -86,6 +462,11 @@ func main() {
 			rom2 := devices.NewI2716(0x2000)
 			rom3 := devices.NewI2716(0x3000)
 
+			rom0.Wait = *romWaitStates
+			rom1.Wait = *romWaitStates
+			rom2.Wait = *romWaitStates
+			rom3.Wait = *romWaitStates
+
 			loadBinFile("bank0.bin", rom0.ROM[:])
 			loadBinFile("bank1.bin", rom1.ROM[:])
 			loadBinFile("bank2.bin", rom2.ROM[:])
@@ -95,6 +476,7 @@ func main() {
 			sim.Bus.MemoryDevices = append(sim.Bus.MemoryDevices, rom1)
 			sim.Bus.MemoryDevices = append(sim.Bus.MemoryDevices, rom2)
 			sim.Bus.MemoryDevices = append(sim.Bus.MemoryDevices, rom3)
+			romDevices = append(romDevices, rom0, rom1, rom2, rom3)
 
 			// ram
 			ram := devices.NewKR537RU2()
@@ -103,11 +485,15 @@ func main() {
 			rom0 := devices.NewSST39SF010A()
 			rom1 := devices.NewAT28C256()
 
+			rom0.Wait = *romWaitStates
+			rom1.Wait = *romWaitStates
+
 			loadBinFile("rom0.bin", rom0.ROM[:])
 			loadBinFile("rom1.bin", rom1.ROM[:])
 
 			sim.Bus.MemoryDevices = append(sim.Bus.MemoryDevices, rom0)
 			sim.Bus.MemoryDevices = append(sim.Bus.MemoryDevices, rom1)
+			romDevices = append(romDevices, rom0, rom1)
 
 			ram := devices.NewAS6C62256()
 			sim.Bus.MemoryDevices = append(sim.Bus.MemoryDevices, ram)
@@ -123,20 +509,131 @@ func main() {
 		pio := devices.NewI8255()
 		st7565p = devices.NewST7565P(pio)
 		sim.Bus.MemoryDevices = append(sim.Bus.MemoryDevices, st7565p)
-		sim.Bus.MemoryDevices = append(sim.Bus.MemoryDevices, devices.NewI8251())
+		uart := devices.NewI8251()
+		if *serialInterrupt {
+			uart.ConnectInterrupt(sim.Bus.Interrupts)
+		}
+		sim.Bus.MemoryDevices = append(sim.Bus.MemoryDevices, uart)
 		sim.Bus.MemoryDevices = append(sim.Bus.MemoryDevices, pio)
 
+		// inputs are applied between instructions, so they can be recorded and replayed
+		inputs = replay.NewInputs(pio, uart)
+		st7565p.ButtonHandler = inputs.SetButtons
+		uart.SetReceiveHandler(inputs.ReceiveByte)
+		if *recordInput != "" {
+			file, err := os.Create(*recordInput)
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = inputs.StartRecording(file, *seed)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if recording != nil {
+			inputs.StartReplay(recording)
+		}
+
+		for _, warning := range sim.Bus.CheckAccessTimes(*clockSpeed) {
+			log.Println("Warning:", warning)
+		}
+
+		if measureCoverage {
+			romCoverage = coverage.NewCoverage(&sim, romDevices...)
+		}
+
+		dbg.Inputs = inputs
+		if *rewindBudget > 0 && inputs.Active() {
+			log.Println("Stepping back is turned off while recording or replaying input")
+		} else if *rewindBudget > 0 {
+			dbg.History = rewind.NewHistory(&sim, *rewindBudget*1024*1024)
+			inputs.BeforeChange = dbg.History.Changing
+		}
+
+		if *loadState != "" {
+			err := savestate.LoadFile(*loadState, &sim)
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("Loaded save state from %s", *loadState)
+		}
+
+		st7565p.HotkeyHandler = func(key sdl.Keycode) {
+			if key == sdl.K_F5 {
+				cpuMutex.Lock()
+				err := savestate.SaveFile(*stateFile, &sim)
+				cpuMutex.Unlock()
+				if err != nil {
+					log.Println(err)
+					return
+				}
+				log.Printf("Saved state to %s", *stateFile)
+			} else if key == sdl.K_F9 {
+				cpuMutex.Lock()
+				err := replay.ErrActive
+				if !inputs.Active() {
+					err = savestate.LoadFile(*stateFile, &sim)
+				}
+				if err == nil && dbg.History != nil {
+					dbg.History.Clear()
+				}
+				cpuMutex.Unlock()
+				if err != nil {
+					log.Println(err)
+					return
+				}
+				log.Printf("Loaded save state from %s", *stateFile)
+			} else if key == sdl.K_BACKSPACE && dbg.History != nil {
+				cpuMutex.Lock()
+				steps := dbg.History.Rewind(uint64(rewindSeconds * *clockSpeed))
+				cpuMutex.Unlock()
+				log.Printf("Rewound %d instructions", steps)
+			}
+		}
+
 		// start the cpu
-		go cpuRoutine(&sim, &cpuMutex, dbg)
+		go cpuRoutine(&sim, &cpuMutex, dbg, tracer, inputs, romCoverage, *clockSpeed, *strictCPU)
 	})
+
+	cpuMutex.Lock()
+	err := inputs.Flush()
+	cpuMutex.Unlock()
+	if err != nil {
+		log.Println(err)
+	}
+
+	if profile != nil {
+		cpuMutex.Lock()
+		writeProfile(profile, *profileFile, *profileReport)
+		cpuMutex.Unlock()
+	}
+
+	if romCoverage != nil {
+		cpuMutex.Lock()
+		writeCoverage(romCoverage, listings, *coverageListing, *coverageLCOV, *coverageCobertura)
+		cpuMutex.Unlock()
+	}
+
+	if tracer != nil {
+		cpuMutex.Lock()
+		err := tracer.Flush()
+		cpuMutex.Unlock()
+		if err != nil {
+			log.Println(err)
+		}
+	}
 }
 
-func cpuRoutine(sim *cpu.CPU, cpuMutex *sync.Mutex, dbg *debugger.Debugger) {
+func cpuRoutine(sim *cpu.CPU, cpuMutex *sync.Mutex, dbg *debugger.Debugger, tracer *trace.Tracer, inputs *replay.Inputs, romCoverage *coverage.Coverage, clockSpeed int, strictCPU bool) {
 	defer (func() {
 		err := recover()
 		if err != nil {
 			log.Println("PANIC")
-			log.Printf("PC: 0x%x", sim.PC)
+			if _, ok := sim.Symbols.Lookup(sim.PC); ok {
+				log.Printf("PC: 0x%x (%s)", sim.PC, sim.Symbols.Format(sim.PC))
+			} else {
+				log.Printf("PC: 0x%x", sim.PC)
+			}
 
 			info, disassembly, bytes := cpu.DisassembleInstructionAt(sim, sim.PC)
 
@@ -147,33 +644,95 @@ func cpuRoutine(sim *cpu.CPU, cpuMutex *sync.Mutex, dbg *debugger.Debugger) {
 	})()
 
 	cycle := 0
+	// with --strict-cpu, stepping again after stopping runs the undocumented instruction anyway
+	allowUndocumented := false
+	// resuming from a breakpoint runs the instruction it stopped at, instead of stopping there again
+	skipBreakpoint := false
+	clockStart := time.Now()
+	clockStartCycles := sim.Cycles
 	for {
 		if dbg.SingleStep {
 			<-dbg.StepChannel
+			skipBreakpoint = true
+			clockStart = time.Now()
+			clockStartCycles = sim.Cycles
 		}
 
 		cpuMutex.Lock()
-		// info, disassembly, bytes := cpu.DisassembleInstructionAt(sim, sim.PC)
+		if !dbg.SingleStep && !skipBreakpoint {
+			breakpoint := dbg.Breakpoints.Check(sim)
+			if breakpoint != nil {
+				log.Printf("Breakpoint at %s triggered! (hits: %d)", sim.Symbols.Format(breakpoint.Address), breakpoint.Hits)
+				if tracer != nil {
+					tracer.BreakpointHit()
+				}
+				st7565p.PausedForBreakpoint = true
+				dbg.SingleStep = true
+				cpuMutex.Unlock()
+				continue
+			}
+		}
+		skipBreakpoint = false
 
-		// log.Printf("%s %s (%d bytes)", info.Mnemonic, disassembly, bytes)
-		// log.Printf("%+v", sim.Registers)
+		// the step starts before the inputs are applied, so that stepping back undoes them
+		if dbg.History != nil {
+			dbg.History.Record()
+		}
+		err := inputs.Apply(sim.Cycles)
+		if err != nil {
+			log.Println(err)
+		}
+		if tracer != nil {
+			err := tracer.Trace(sim)
+			if err != nil {
+				log.Println("Stopped tracing:", err)
+				tracer = nil
+			}
+		}
 
-		err := sim.Step(func() {
+		if romCoverage != nil {
+			romCoverage.Begin()
+		}
+		sim.Strict = strictCPU && !allowUndocumented
+		err = sim.Step(func() {
 			log.Println("Breakpoint triggered!")
+			if tracer != nil {
+				tracer.BreakpointHit()
+			}
 			st7565p.PausedForBreakpoint = true
 			dbg.SingleStep = true
 		})
+		allowUndocumented = errors.Is(err, cpu.ErrUndocumented)
+		dbg.Fault = err
 		if err != nil {
-			panic(err)
+			// stop at the faulting instruction, so it can be looked at in the debugger
+			log.Println(err)
+			st7565p.PausedForBreakpoint = true
+			dbg.SingleStep = true
 		}
 		cpuMutex.Unlock()
 
-		time.Sleep(time.Second / 10000000)
-
 		if !dbg.SingleStep {
 			cycle += 1
 			if cycle > 1000 {
 				cycle = 0
+
+				if sim.Cycles < clockStartCycles {
+					// it went back in time, from rewinding or loading a save state
+					clockStart = time.Now()
+					clockStartCycles = sim.Cycles
+				}
+
+				// keep the emulated clock in line with the real one
+				emulatedTime := time.Duration(float64(sim.Cycles-clockStartCycles) / float64(clockSpeed) * float64(time.Second))
+				realTime := time.Since(clockStart)
+				if emulatedTime > realTime {
+					time.Sleep(emulatedTime - realTime)
+				} else if realTime-emulatedTime > time.Second/10 {
+					// we've fallen behind, so don't try to catch up all at once
+					clockStart = time.Now()
+					clockStartCycles = sim.Cycles
+				}
 			}
 		}
 	}
@@ -0,0 +1,314 @@
+// Package profiler counts the instructions and cycles spent at each address, and which subroutines they were called from.
+// It writes pprof profiles, so the firmware can be looked at with go tool pprof.
+package profiler
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/thatoddmailbox/computer-emu/cpu"
+)
+
+// function id for code that isn't in any subroutine that was seen being called, like the main loop
+const topLevelFunction = 0x10000
+
+type frame struct {
+	// where the subroutine starts
+	function uint16
+
+	// the instruction that called it, or the one before an interrupt
+	callSite uint16
+
+	// where the return address was pushed
+	sp uint16
+}
+
+type sampleKey struct {
+	stack string
+	pc    uint16
+}
+
+type sampleValue struct {
+	instructions int64
+	cycles       int64
+}
+
+// Profiler is an ExecutionObserver that keeps track of the call stack as calls and returns happen.
+type Profiler struct {
+	cpu *cpu.CPU
+
+	stack    []frame
+	stackKey string
+
+	// every stack that's been seen, by its key
+	stacks  map[string][]frame
+	samples map[sampleKey]*sampleValue
+
+	lastPC uint16
+}
+
+// NewProfiler creates a Profiler and adds it to the cpu's observers.
+func NewProfiler(c *cpu.CPU) *Profiler {
+	p := &Profiler{
+		cpu:     c,
+		stacks:  map[string][]frame{"": nil},
+		samples: map[sampleKey]*sampleValue{},
+	}
+	c.Observers = append(c.Observers, p)
+	return p
+}
+
+func (p *Profiler) Executed(pc uint16, length uint16, cycles uint64) {
+	p.lastPC = pc
+
+	key := sampleKey{p.stackKey, pc}
+	value, ok := p.samples[key]
+	if !ok {
+		value = &sampleValue{}
+		p.samples[key] = value
+	}
+	value.instructions += 1
+	value.cycles += int64(cycles)
+}
+
+func (p *Profiler) Called(target uint16) {
+	// a subroutine that threw away its return address and jumped somewhere instead is still on the stack,
+	// but anything that's really still running has its return address above the new one
+	sp := p.cpu.Registers.SP
+	for len(p.stack) > 0 && int16(sp-p.stack[len(p.stack)-1].sp) >= 0 {
+		p.stack = p.stack[:len(p.stack)-1]
+	}
+
+	p.stack = append(p.stack, frame{target, p.lastPC, sp})
+	p.updateStackKey()
+}
+
+func (p *Profiler) Returned() {
+	// pop everything the return address was above, in case something returned through more than one frame
+	sp := p.cpu.Registers.SP
+	for len(p.stack) > 0 && int16(sp-p.stack[len(p.stack)-1].sp) > 0 {
+		p.stack = p.stack[:len(p.stack)-1]
+	}
+	p.updateStackKey()
+}
+
+func (p *Profiler) updateStackKey() {
+	key := make([]byte, 0, len(p.stack)*4)
+	for _, stackFrame := range p.stack {
+		key = append(key, uint8(stackFrame.function>>8), uint8(stackFrame.function), uint8(stackFrame.callSite>>8), uint8(stackFrame.callSite))
+	}
+	p.stackKey = string(key)
+
+	_, ok := p.stacks[p.stackKey]
+	if !ok {
+		p.stacks[p.stackKey] = append([]frame{}, p.stack...)
+	}
+}
+
+// systemName is the name a subroutine has without any labels
+func systemName(function int) string {
+	if function == topLevelFunction {
+		return "(top level)"
+	}
+	return fmt.Sprintf("sub_%04X", function)
+}
+
+// functionName names a subroutine from the cpu's labels, if there's one at or before it
+func (p *Profiler) functionName(function int) string {
+	if function == topLevelFunction {
+		return systemName(function)
+	}
+	if _, ok := p.cpu.Symbols.Lookup(uint16(function)); ok {
+		return p.cpu.Symbols.Format(uint16(function))
+	}
+	return systemName(function)
+}
+
+// the functions in a stack, from the innermost one out
+func stackFunctions(stack []frame) []int {
+	functions := make([]int, 0, len(stack)+1)
+	for i := len(stack) - 1; i >= 0; i-- {
+		functions = append(functions, int(stack[i].function))
+	}
+	return append(functions, topLevelFunction)
+}
+
+// WriteProfile writes a gzipped pprof profile, with the instruction count and cycles as its sample types.
+func (p *Profiler) WriteProfile(w io.Writer) error {
+	strings := []string{""}
+	stringIndexes := map[string]int64{"": 0}
+	stringIndex := func(value string) int64 {
+		index, ok := stringIndexes[value]
+		if !ok {
+			index = int64(len(strings))
+			strings = append(strings, value)
+			stringIndexes[value] = index
+		}
+		return index
+	}
+
+	profile := protobufBuffer{}
+
+	valueType := func(field int, valueName string, unit string) {
+		message := protobufBuffer{}
+		message.int64Field(1, stringIndex(valueName))
+		message.int64Field(2, stringIndex(unit))
+		profile.messageField(field, &message)
+	}
+	valueType(1, "instructions", "count")
+	valueType(1, "cycles", "count")
+
+	functions := map[int]bool{}
+	type locationKey struct {
+		address  uint16
+		function int
+	}
+	locations := map[locationKey]uint64{}
+	locationOrder := []locationKey{}
+	locationID := func(address uint16, function int) uint64 {
+		key := locationKey{address, function}
+		id, ok := locations[key]
+		if !ok {
+			id = uint64(len(locationOrder) + 1)
+			locations[key] = id
+			locationOrder = append(locationOrder, key)
+			functions[function] = true
+		}
+		return id
+	}
+
+	for key, value := range p.samples {
+		stack := p.stacks[key.stack]
+		stackFunctions := stackFunctions(stack)
+
+		// the instruction itself, then each call site, which is in the function one further out
+		locationIDs := []uint64{locationID(key.pc, stackFunctions[0])}
+		for i := len(stack) - 1; i >= 0; i-- {
+			locationIDs = append(locationIDs, locationID(stack[i].callSite, stackFunctions[len(stack)-i]))
+		}
+
+		sample := protobufBuffer{}
+		sample.packedUint64Field(1, locationIDs)
+		sample.packedInt64Field(2, []int64{value.instructions, value.cycles})
+		profile.messageField(2, &sample)
+	}
+
+	for i, key := range locationOrder {
+		line := protobufBuffer{}
+		line.uint64Field(1, uint64(key.function)+1)
+
+		location := protobufBuffer{}
+		location.uint64Field(1, uint64(i+1))
+		location.uint64Field(3, uint64(key.address))
+		location.messageField(4, &line)
+		profile.messageField(4, &location)
+	}
+
+	for function := range functions {
+		message := protobufBuffer{}
+		message.uint64Field(1, uint64(function)+1)
+		message.int64Field(2, stringIndex(p.functionName(function)))
+		message.int64Field(3, stringIndex(systemName(function)))
+		profile.messageField(5, &message)
+	}
+
+	// each cycle is a sample
+	periodType := protobufBuffer{}
+	periodType.int64Field(1, stringIndex("cycles"))
+	periodType.int64Field(2, stringIndex("count"))
+	profile.messageField(11, &periodType)
+	profile.int64Field(12, 1)
+	profile.int64Field(14, stringIndex("cycles"))
+
+	// the string table has to come last, since everything above adds to it
+	for _, value := range strings {
+		profile.stringField(6, value)
+	}
+
+	compressed := gzip.NewWriter(w)
+	_, err := compressed.Write(profile.data)
+	if err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+type functionTotals struct {
+	function   int
+	flat       sampleValue
+	cumulative sampleValue
+}
+
+// WriteReport writes a flat text report of the cycles spent in each subroutine, like pprof's top.
+// Flat is what was spent in the subroutine itself, and cumulative includes what it called.
+func (p *Profiler) WriteReport(w io.Writer) error {
+	totals := map[int]*functionTotals{}
+	total := sampleValue{}
+	for key, value := range p.samples {
+		total.instructions += value.instructions
+		total.cycles += value.cycles
+
+		seen := map[int]bool{}
+		for i, function := range stackFunctions(p.stacks[key.stack]) {
+			functionTotal, ok := totals[function]
+			if !ok {
+				functionTotal = &functionTotals{function: function}
+				totals[function] = functionTotal
+			}
+			if i == 0 {
+				functionTotal.flat.instructions += value.instructions
+				functionTotal.flat.cycles += value.cycles
+			}
+			if !seen[function] {
+				// recursion only counts once
+				functionTotal.cumulative.instructions += value.instructions
+				functionTotal.cumulative.cycles += value.cycles
+				seen[function] = true
+			}
+		}
+	}
+
+	sorted := []*functionTotals{}
+	for _, functionTotal := range totals {
+		sorted = append(sorted, functionTotal)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].flat.cycles != sorted[j].flat.cycles {
+			return sorted[i].flat.cycles > sorted[j].flat.cycles
+		}
+		return sorted[i].cumulative.cycles > sorted[j].cumulative.cycles
+	})
+
+	percent := func(value int64) float64 {
+		if total.cycles == 0 {
+			return 0
+		}
+		return 100 * float64(value) / float64(total.cycles)
+	}
+
+	_, err := fmt.Fprintf(w, "Total: %d instructions, %d cycles\n%12s %7s %7s %12s %7s %14s  %s\n", total.instructions, total.cycles, "flat", "flat%", "sum%", "cum", "cum%", "instructions", "subroutine")
+	if err != nil {
+		return err
+	}
+	sum := int64(0)
+	for _, functionTotal := range sorted {
+		sum += functionTotal.flat.cycles
+		_, err = fmt.Fprintf(
+			w,
+			"%12d %6.2f%% %6.2f%% %12d %6.2f%% %14d  %s\n",
+			functionTotal.flat.cycles,
+			percent(functionTotal.flat.cycles),
+			percent(sum),
+			functionTotal.cumulative.cycles,
+			percent(functionTotal.cumulative.cycles),
+			functionTotal.flat.instructions,
+			p.functionName(functionTotal.function),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
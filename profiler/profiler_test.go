@@ -0,0 +1,50 @@
+package profiler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/thatoddmailbox/computer-emu/cpu"
+	"github.com/thatoddmailbox/computer-emu/devices"
+	"github.com/thatoddmailbox/computer-emu/symbols"
+)
+
+func TestReportUsesLabels(t *testing.T) {
+	c := &cpu.CPU{}
+	rom := devices.NewI2716(0x0000)
+	ram := devices.NewKR537RU2()
+	c.Bus.MemoryDevices = append(c.Bus.MemoryDevices, rom, ram)
+	// ld sp, 0xF800; call 0x0010; call 0x0012; halt; ... 0x0010: nop; ret; 0x0012: ret
+	copy(rom.ROM[:], []byte{0x31, 0x00, 0xF8, 0xCD, 0x10, 0x00, 0xCD, 0x12, 0x00, 0x76})
+	copy(rom.ROM[0x10:], []byte{0x00, 0xC9, 0xC9})
+
+	c.Symbols = &symbols.Symbols{}
+	c.Symbols.Add(&symbols.Table{
+		Start:   0x0000,
+		End:     0xFFFF,
+		Symbols: []symbols.Symbol{{Name: "print_string", Address: 0x0010}},
+	})
+
+	p := NewProfiler(c)
+	for !c.Halted {
+		err := c.Step(func() {})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report := &bytes.Buffer{}
+	err := p.WriteReport(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"print_string\n", "print_string+0x2\n", "(top level)\n"} {
+		if !strings.Contains(report.String(), name) {
+			t.Errorf("report doesn't have %q:\n%s", name, report.String())
+		}
+	}
+	if strings.Contains(report.String(), "sub_0010") {
+		t.Errorf("report has sub_0010 instead of its label:\n%s", report.String())
+	}
+}
@@ -0,0 +1,68 @@
+package profiler
+
+// just enough of the protobuf wire format to write a pprof profile, see
+// https://github.com/google/pprof/blob/master/proto/profile.proto
+
+const (
+	wireVarint      = 0
+	wireLengthDelim = 2
+)
+
+type protobufBuffer struct {
+	data []byte
+}
+
+func (b *protobufBuffer) varint(value uint64) {
+	for value >= 0x80 {
+		b.data = append(b.data, uint8(value)|0x80)
+		value >>= 7
+	}
+	b.data = append(b.data, uint8(value))
+}
+
+func (b *protobufBuffer) key(field int, wireType int) {
+	b.varint(uint64(field<<3 | wireType))
+}
+
+func (b *protobufBuffer) uint64Field(field int, value uint64) {
+	if value == 0 {
+		// zero is the default, so it's left out
+		return
+	}
+	b.key(field, wireVarint)
+	b.varint(value)
+}
+
+func (b *protobufBuffer) int64Field(field int, value int64) {
+	b.uint64Field(field, uint64(value))
+}
+
+func (b *protobufBuffer) bytesField(field int, value []byte) {
+	b.key(field, wireLengthDelim)
+	b.varint(uint64(len(value)))
+	b.data = append(b.data, value...)
+}
+
+func (b *protobufBuffer) stringField(field int, value string) {
+	b.bytesField(field, []byte(value))
+}
+
+func (b *protobufBuffer) messageField(field int, message *protobufBuffer) {
+	b.bytesField(field, message.data)
+}
+
+func (b *protobufBuffer) packedUint64Field(field int, values []uint64) {
+	packed := protobufBuffer{}
+	for _, value := range values {
+		packed.varint(value)
+	}
+	b.bytesField(field, packed.data)
+}
+
+func (b *protobufBuffer) packedInt64Field(field int, values []int64) {
+	packed := protobufBuffer{}
+	for _, value := range values {
+		packed.varint(uint64(value))
+	}
+	b.bytesField(field, packed.data)
+}
@@ -0,0 +1,224 @@
+// Package replay records the buttons and serial input with the cycle they were applied at, so that a run can be played back exactly.
+package replay
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/thatoddmailbox/computer-emu/bus"
+	"github.com/thatoddmailbox/computer-emu/devices"
+)
+
+// Version is bumped whenever the layout of a recording changes.
+const Version = 1
+
+var magic = [8]byte{'C', 'E', 'M', 'U', 'I', 'N', 'P', 'T'}
+
+var ErrNotRecording = errors.New("replay: not an input recording")
+var ErrWrongVersion = errors.New("replay: unsupported version")
+var ErrWentBack = errors.New("replay: the cycle count went backwards")
+var ErrActive = errors.New("replay: can't change the computer's state while recording or replaying input")
+
+type InputKind uint8
+
+const (
+	// Data is the new state of the PIO's port A
+	InputButtons InputKind = iota + 1
+
+	// Data is a byte received by the UART
+	InputSerial
+)
+
+// Input is something from outside the computer, which a recording has one of for each change.
+type Input struct {
+	Cycle uint64
+	Kind  InputKind
+	Data  uint8
+}
+
+// a recording is the magic, version, and seed, then each of the inputs in order until the end of the file
+type header struct {
+	Magic   [8]byte
+	Version uint16
+	Seed    int64
+}
+
+// Recording is a recording that's been read back in.
+type Recording struct {
+	// what the random number generator was seeded with, which is used for --random-ram
+	Seed int64
+
+	Inputs []Input
+}
+
+func ReadRecording(r io.Reader) (*Recording, error) {
+	reader := bufio.NewReader(r)
+
+	fileHeader := header{}
+	err := binary.Read(reader, binary.LittleEndian, &fileHeader)
+	if err != nil {
+		return nil, err
+	}
+	if fileHeader.Magic != magic {
+		return nil, ErrNotRecording
+	}
+	if fileHeader.Version != Version {
+		return nil, fmt.Errorf("%w: %d", ErrWrongVersion, fileHeader.Version)
+	}
+
+	recording := &Recording{
+		Seed: fileHeader.Seed,
+	}
+	for {
+		input := Input{}
+		err = binary.Read(reader, binary.LittleEndian, &input)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		recording.Inputs = append(recording.Inputs, input)
+	}
+	return recording, nil
+}
+
+// Inputs holds on to the buttons and serial input until the cpu is between instructions, so that they happen at a known cycle.
+// SetButtons and ReceiveByte can be called from any goroutine, but everything else should be called from the one running the cpu.
+type Inputs struct {
+	PIO  *devices.I8255
+	UART *devices.I8251
+
+	// if set, called right before an input changes a device, so that a rewind.History can undo it
+	BeforeChange func(device bus.StatefulDevice)
+
+	mutex       sync.Mutex
+	queued      []Input
+	queuedCount int32
+
+	recording *bufio.Writer
+	replaying []Input
+
+	// the cycle Apply was last called with
+	lastCycle uint64
+}
+
+func NewInputs(pio *devices.I8255, uart *devices.I8251) *Inputs {
+	return &Inputs{
+		PIO:  pio,
+		UART: uart,
+	}
+}
+
+// StartRecording writes out every input as it's applied, including ones from a replay, after a header with the seed.
+func (i *Inputs) StartRecording(w io.Writer, seed int64) error {
+	i.recording = bufio.NewWriter(w)
+	return binary.Write(i.recording, binary.LittleEndian, &header{magic, Version, seed})
+}
+
+// StartReplay applies the recording's inputs at the cycles they were recorded at. Live input is ignored until the last one has been applied.
+func (i *Inputs) StartReplay(recording *Recording) {
+	i.replaying = recording.Inputs
+}
+
+// Active returns whether inputs are being recorded or replayed. Anything that goes back in time or changes the computer's state,
+// like rewinding, loading a save state, or patching memory, would get out of step with the recording, so it shouldn't be done then.
+// A nil *Inputs is never active.
+func (i *Inputs) Active() bool {
+	if i == nil {
+		return false
+	}
+	return i.recording != nil || len(i.replaying) > 0
+}
+
+func (i *Inputs) queue(input Input) {
+	i.mutex.Lock()
+	i.queued = append(i.queued, input)
+	atomic.StoreInt32(&i.queuedCount, int32(len(i.queued)))
+	i.mutex.Unlock()
+}
+
+func (i *Inputs) SetButtons(buttons uint8) {
+	i.queue(Input{Kind: InputButtons, Data: buttons})
+}
+
+func (i *Inputs) ReceiveByte(b byte) {
+	i.queue(Input{Kind: InputSerial, Data: b})
+}
+
+func (i *Inputs) beforeChange(device bus.StatefulDevice) {
+	if i.BeforeChange != nil {
+		i.BeforeChange(device)
+	}
+}
+
+func (i *Inputs) apply(input Input) error {
+	switch input.Kind {
+	case InputButtons:
+		i.beforeChange(i.PIO)
+		i.PIO.SetPortA(input.Data)
+	case InputSerial:
+		i.beforeChange(i.UART)
+		i.UART.Receive(input.Data)
+	}
+
+	if i.recording != nil {
+		return binary.Write(i.recording, binary.LittleEndian, &input)
+	}
+	return nil
+}
+
+// Apply applies anything that's due by the given cycle, and should be called right before the cpu steps.
+// It returns ErrWentBack if the cycle is before the last one while recording or replaying, since the recording can't be matched up with it any more.
+func (i *Inputs) Apply(cycle uint64) error {
+	lastCycle := i.lastCycle
+	i.lastCycle = cycle
+	if cycle < lastCycle && i.Active() {
+		return fmt.Errorf("%w: from %d to %d", ErrWentBack, lastCycle, cycle)
+	}
+
+	for len(i.replaying) > 0 && i.replaying[0].Cycle <= cycle {
+		input := i.replaying[0]
+		i.replaying = i.replaying[1:]
+		err := i.apply(input)
+		if err != nil {
+			return err
+		}
+	}
+
+	if atomic.LoadInt32(&i.queuedCount) == 0 {
+		return nil
+	}
+
+	i.mutex.Lock()
+	queued := i.queued
+	i.queued = nil
+	atomic.StoreInt32(&i.queuedCount, 0)
+	i.mutex.Unlock()
+
+	if len(i.replaying) > 0 {
+		// the replay is still going
+		return nil
+	}
+
+	for _, input := range queued {
+		input.Cycle = cycle
+		err := i.apply(input)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes out anything that's buffered in the recording.
+func (i *Inputs) Flush() error {
+	if i.recording == nil {
+		return nil
+	}
+	return i.recording.Flush()
+}
@@ -0,0 +1,122 @@
+package replay
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/thatoddmailbox/computer-emu/devices"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	pio := devices.NewI8255()
+	inputs := NewInputs(pio, nil)
+	recorded := &bytes.Buffer{}
+	err := inputs.StartRecording(recorded, 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inputs.Active() {
+		t.Error("expected recording to be active")
+	}
+
+	// presses at cycle 100 and 250
+	steps := []struct {
+		cycle   uint64
+		buttons int
+	}{
+		{0, -1},
+		{100, 0x80},
+		{180, -1},
+		{250, 0x00},
+	}
+	for _, step := range steps {
+		if step.buttons != -1 {
+			inputs.SetButtons(uint8(step.buttons))
+		}
+		err = inputs.Apply(step.cycle)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = inputs.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recording, err := ReadRecording(recorded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Input{{100, InputButtons, 0x80}, {250, InputButtons, 0x00}}
+	if recording.Seed != 1234 || len(recording.Inputs) != len(expected) {
+		t.Fatalf("read back %+v", recording)
+	}
+	for i, input := range recording.Inputs {
+		if input != expected[i] {
+			t.Errorf("input %d was %+v, expected %+v", i, input, expected[i])
+		}
+	}
+
+	replayedPIO := devices.NewI8255()
+	replayed := NewInputs(replayedPIO, nil)
+	replayed.StartReplay(recording)
+
+	// live input is ignored until the replay's over
+	replayed.SetButtons(0x01)
+	portA := []struct {
+		cycle uint64
+		value uint8
+	}{
+		{99, 0x00},
+		{100, 0x80},
+		{249, 0x80},
+		{250, 0x00},
+	}
+	for _, step := range portA {
+		err = replayed.Apply(step.cycle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if replayedPIO.GetPortA() != step.value {
+			t.Errorf("port a was 0x%02X at cycle %d, expected 0x%02X", replayedPIO.GetPortA(), step.cycle, step.value)
+		}
+	}
+	if replayed.Active() {
+		t.Error("expected the replay to be over")
+	}
+
+	replayed.SetButtons(0x04)
+	err = replayed.Apply(300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayedPIO.GetPortA() != 0x04 {
+		t.Errorf("live input wasn't applied after the replay")
+	}
+}
+
+func TestWentBack(t *testing.T) {
+	inputs := NewInputs(devices.NewI8255(), nil)
+	err := inputs.Apply(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = inputs.Apply(50)
+	if err != nil {
+		t.Errorf("going back without recording or replaying should be fine, got %v", err)
+	}
+
+	err = inputs.StartRecording(&bytes.Buffer{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = inputs.Apply(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = inputs.Apply(50)
+	if !errors.Is(err, ErrWentBack) {
+		t.Errorf("expected ErrWentBack, got %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+// Package rewind keeps a history of what each instruction changed, so that execution can be stepped backwards.
+package rewind
+
+import (
+	"bytes"
+
+	"github.com/thatoddmailbox/computer-emu/bus"
+	"github.com/thatoddmailbox/computer-emu/cpu"
+)
+
+// rough sizes, in bytes, for keeping the history within its budget
+const (
+	stepSize        = 80
+	memoryWriteSize = 24
+	deviceStateSize = 40
+)
+
+// a byte of memory from before it was written
+type memoryWrite struct {
+	device  bus.BusMemoryIODevice
+	address uint16
+	old     uint8
+}
+
+// a device that isn't plain memory, from before it was first accessed in a step
+type deviceState struct {
+	device bus.StatefulDevice
+	state  []byte
+}
+
+// the cpu's state before an instruction ran, and how many of the writes and device states after the previous step's belong to it
+type step struct {
+	cpu          cpu.State
+	writes       int
+	deviceStates int
+}
+
+// History records the cpu and what each step changes on the bus. Everything that changes the cpu, including the history, has to hold the same lock.
+type History struct {
+	// roughly how much memory the history can use before the oldest steps are forgotten, in bytes
+	Budget int
+
+	cpu *cpu.CPU
+
+	steps        []step
+	writes       []memoryWrite
+	deviceStates []deviceState
+	size         int
+}
+
+// NewHistory creates a History and hooks it into the cpu's bus.
+func NewHistory(c *cpu.CPU, budget int) *History {
+	h := &History{
+		Budget: budget,
+		cpu:    c,
+	}
+	c.Bus.Hooks = append(c.Bus.Hooks, h)
+	return h
+}
+
+// Record starts a new step, and should be called right before the cpu steps.
+func (h *History) Record() {
+	h.steps = append(h.steps, step{cpu: h.cpu.State()})
+	h.size += stepSize
+
+	for h.size > h.Budget && len(h.steps) > 1 {
+		h.forgetOldest()
+	}
+}
+
+// Len returns how many steps can be undone.
+func (h *History) Len() int {
+	return len(h.steps)
+}
+
+// Clear forgets everything, for when the machine's state changed some other way, like loading a save state.
+func (h *History) Clear() {
+	h.steps = nil
+	h.writes = nil
+	h.deviceStates = nil
+	h.size = 0
+}
+
+func (h *History) forgetOldest() {
+	oldest := h.steps[0]
+	for _, state := range h.deviceStates[:oldest.deviceStates] {
+		h.size -= deviceStateSize + len(state.state)
+	}
+	h.size -= stepSize + oldest.writes*memoryWriteSize
+
+	h.writes = h.writes[oldest.writes:]
+	h.deviceStates = h.deviceStates[oldest.deviceStates:]
+	h.steps = h.steps[1:]
+}
+
+func (h *History) MemoryAccess(device bus.BusMemoryIODevice, address uint16, write bool) {
+	if len(h.steps) == 0 {
+		return
+	}
+
+	peekableDevice, ok := device.(bus.PeekableDevice)
+	if ok {
+		// reading memory doesn't change it
+		if write {
+			h.writes = append(h.writes, memoryWrite{device, address, peekableDevice.PeekByte(address)})
+			h.steps[len(h.steps)-1].writes += 1
+			h.size += memoryWriteSize
+		}
+		return
+	}
+
+	// other devices can change when they're read, like the display's column address
+	statefulDevice, ok := device.(bus.StatefulDevice)
+	if ok {
+		h.saveDevice(statefulDevice)
+	}
+}
+
+func (h *History) IOAccess(device bus.BusDataIODevice, address uint8, write bool) {
+	if len(h.steps) == 0 {
+		return
+	}
+
+	statefulDevice, ok := device.(bus.StatefulDevice)
+	if ok {
+		h.saveDevice(statefulDevice)
+	}
+}
+
+// Changing keeps the device's state from before it's changed some way other than through the bus, like an input,
+// so that stepping back undoes that too. It should be called after Record, right before the change.
+func (h *History) Changing(device bus.StatefulDevice) {
+	if len(h.steps) == 0 {
+		return
+	}
+	h.saveDevice(device)
+}
+
+func (h *History) saveDevice(device bus.StatefulDevice) {
+	current := &h.steps[len(h.steps)-1]
+	for _, state := range h.deviceStates[len(h.deviceStates)-current.deviceStates:] {
+		if state.device == device {
+			// only the state from before the first access matters
+			return
+		}
+	}
+
+	state := bytes.Buffer{}
+	err := device.SaveState(&state)
+	if err != nil {
+		// there's nothing to go back to, so stepping back will leave the device as it is
+		return
+	}
+
+	h.deviceStates = append(h.deviceStates, deviceState{device, state.Bytes()})
+	current.deviceStates += 1
+	h.size += deviceStateSize + state.Len()
+}
+
+// StepBack undoes the last step, returning false if there's nothing left to undo.
+func (h *History) StepBack() bool {
+	if len(h.steps) == 0 {
+		return false
+	}
+	last := h.steps[len(h.steps)-1]
+	h.steps = h.steps[:len(h.steps)-1]
+
+	// undo in reverse, so that the oldest value of anything written twice wins
+	writes := h.writes[len(h.writes)-last.writes:]
+	for i := len(writes) - 1; i >= 0; i-- {
+		// this goes straight to the device, so there's nothing recorded for it
+		writes[i].device.WriteByte(writes[i].address, writes[i].old)
+	}
+	h.writes = h.writes[:len(h.writes)-last.writes]
+
+	deviceStates := h.deviceStates[len(h.deviceStates)-last.deviceStates:]
+	for _, state := range deviceStates {
+		state.device.LoadState(bytes.NewReader(state.state))
+		h.size -= deviceStateSize + len(state.state)
+	}
+	h.deviceStates = h.deviceStates[:len(h.deviceStates)-last.deviceStates]
+
+	h.cpu.SetState(last.cpu)
+	h.size -= stepSize + last.writes*memoryWriteSize
+	return true
+}
+
+// StepBackUntil steps back at least once, and then until stop returns true or there's nothing left to undo.
+// It returns the number of steps undone.
+func (h *History) StepBackUntil(stop func(c *cpu.CPU) bool) int {
+	count := 0
+	for h.StepBack() {
+		count += 1
+		if stop(h.cpu) {
+			break
+		}
+	}
+	return count
+}
+
+// Rewind steps back until the cpu has gone back at least the given number of t-states, or there's nothing left to undo.
+// It returns the number of steps undone.
+func (h *History) Rewind(cycles uint64) int {
+	target := uint64(0)
+	if h.cpu.Cycles > cycles {
+		target = h.cpu.Cycles - cycles
+	}
+	return h.StepBackUntil(func(c *cpu.CPU) bool {
+		return c.Cycles <= target
+	})
+}
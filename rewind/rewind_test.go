@@ -0,0 +1,89 @@
+package rewind
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/thatoddmailbox/computer-emu/bus"
+	"github.com/thatoddmailbox/computer-emu/cpu"
+	"github.com/thatoddmailbox/computer-emu/devices"
+	"github.com/thatoddmailbox/computer-emu/replay"
+)
+
+func savedState(t *testing.T, device bus.StatefulDevice) []byte {
+	t.Helper()
+	state := bytes.Buffer{}
+	err := device.SaveState(&state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state.Bytes()
+}
+
+func TestStepBackUndoesInputs(t *testing.T) {
+	c := &cpu.CPU{}
+	rom := devices.NewI2716(0x0000)
+	ram := devices.NewKR537RU2()
+	c.Bus.MemoryDevices = append(c.Bus.MemoryDevices, rom, ram)
+	// ld a, 0x12; ld (0xF000), a; nop; nop
+	copy(rom.ROM[:], []byte{0x3E, 0x12, 0x32, 0x00, 0xF0, 0x00, 0x00})
+
+	pio := devices.NewI8255()
+	uart := devices.NewI8251()
+	// only the replayed input should reach it, not whatever's on stdin
+	uart.SetReceiveHandler(func(b byte) {})
+	inputs := replay.NewInputs(pio, uart)
+	history := NewHistory(c, 1024*1024)
+	inputs.BeforeChange = history.Changing
+
+	step := func() {
+		history.Record()
+		err := inputs.Apply(c.Cycles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.Step(func() {})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	step()
+	step()
+	uartBefore := savedState(t, uart)
+
+	// these are applied in the middle of the history, at the start of the third step
+	inputs.SetButtons(0x80)
+	inputs.ReceiveByte('A')
+	step()
+	step()
+
+	if pio.GetPortA() != 0x80 {
+		t.Fatalf("port A was 0x%02x after the input, expected 0x80", pio.GetPortA())
+	}
+
+	history.StepBack()
+	if pio.GetPortA() != 0x80 {
+		t.Errorf("port A was 0x%02x after stepping back past a step without input, expected 0x80", pio.GetPortA())
+	}
+
+	history.StepBack()
+	if pio.GetPortA() != 0x00 {
+		t.Errorf("port A was 0x%02x after stepping back past the input, expected 0x00", pio.GetPortA())
+	}
+	if !bytes.Equal(savedState(t, uart), uartBefore) {
+		t.Errorf("the uart still had the received byte after stepping back past it")
+	}
+	if c.PC != 0x0005 {
+		t.Errorf("PC was 0x%04x, expected 0x0005", c.PC)
+	}
+
+	for history.StepBack() {
+	}
+	if c.PC != 0x0000 {
+		t.Errorf("PC was 0x%04x after stepping all the way back, expected 0x0000", c.PC)
+	}
+	if ram.PeekByte(0xF000) != 0x00 {
+		t.Errorf("0xF000 was 0x%02x after stepping all the way back, expected 0x00", ram.PeekByte(0xF000))
+	}
+}
@@ -0,0 +1,207 @@
+// Package savestate saves and restores the whole machine: the cpu, and every device on the bus that has state.
+package savestate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/thatoddmailbox/computer-emu/bus"
+	"github.com/thatoddmailbox/computer-emu/cpu"
+)
+
+// Version is bumped whenever the layout of a save state, or of any device's part of it, changes.
+const Version = 1
+
+var magic = [8]byte{'C', 'E', 'M', 'U', 'S', 'T', 'A', 'T'}
+
+var ErrNotSaveState = errors.New("savestate: not a save state")
+var ErrWrongVersion = errors.New("savestate: unsupported version")
+var ErrWrongMachine = errors.New("savestate: saved from a different set of devices")
+
+// a save state is the magic and version, the cpu's section, and then a section for each stateful device, in bus order.
+// each device section has the device's type name and length first, so a state from a different machine is rejected before anything is changed.
+type header struct {
+	Magic   [8]byte
+	Version uint16
+}
+
+type section struct {
+	name string
+	data []byte
+}
+
+func statefulDevices(c *cpu.CPU) []bus.StatefulDevice {
+	devices := []bus.StatefulDevice{}
+	for _, device := range c.Bus.MemoryDevices {
+		statefulDevice, ok := device.(bus.StatefulDevice)
+		if ok {
+			devices = append(devices, statefulDevice)
+		}
+	}
+	for _, device := range c.Bus.DataDevices {
+		statefulDevice, ok := device.(bus.StatefulDevice)
+		if ok {
+			devices = append(devices, statefulDevice)
+		}
+	}
+	return devices
+}
+
+func writeSection(w io.Writer, name string, device bus.StatefulDevice) error {
+	data := bytes.Buffer{}
+	err := device.SaveState(&data)
+	if err != nil {
+		return err
+	}
+
+	err = binary.Write(w, binary.LittleEndian, uint16(len(name)))
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, name)
+	if err != nil {
+		return err
+	}
+	err = binary.Write(w, binary.LittleEndian, uint32(data.Len()))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data.Bytes())
+	return err
+}
+
+func readSection(r io.Reader) (section, error) {
+	nameLength := uint16(0)
+	err := binary.Read(r, binary.LittleEndian, &nameLength)
+	if err != nil {
+		return section{}, err
+	}
+	name := make([]byte, nameLength)
+	_, err = io.ReadFull(r, name)
+	if err != nil {
+		return section{}, err
+	}
+
+	dataLength := uint32(0)
+	err = binary.Read(r, binary.LittleEndian, &dataLength)
+	if err != nil {
+		return section{}, err
+	}
+	data := make([]byte, dataLength)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return section{}, err
+	}
+
+	return section{string(name), data}, nil
+}
+
+// Save writes the state of the cpu and everything on its bus. The cpu shouldn't be running while this happens.
+func Save(w io.Writer, c *cpu.CPU) error {
+	err := binary.Write(w, binary.LittleEndian, &header{magic, Version})
+	if err != nil {
+		return err
+	}
+
+	err = writeSection(w, "cpu", c)
+	if err != nil {
+		return err
+	}
+
+	devices := statefulDevices(c)
+	err = binary.Write(w, binary.LittleEndian, uint16(len(devices)))
+	if err != nil {
+		return err
+	}
+	for _, device := range devices {
+		err = writeSection(w, fmt.Sprintf("%T", device), device)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Load restores a state written by Save. The devices on the bus have to be the same as when it was saved, or it returns ErrWrongMachine without changing anything.
+func Load(r io.Reader, c *cpu.CPU) error {
+	fileHeader := header{}
+	err := binary.Read(r, binary.LittleEndian, &fileHeader)
+	if err != nil {
+		return err
+	}
+	if fileHeader.Magic != magic {
+		return ErrNotSaveState
+	}
+	if fileHeader.Version != Version {
+		return fmt.Errorf("%w: %d", ErrWrongVersion, fileHeader.Version)
+	}
+
+	cpuSection, err := readSection(r)
+	if err != nil {
+		return err
+	}
+
+	devices := statefulDevices(c)
+	deviceCount := uint16(0)
+	err = binary.Read(r, binary.LittleEndian, &deviceCount)
+	if err != nil {
+		return err
+	}
+	if int(deviceCount) != len(devices) {
+		return ErrWrongMachine
+	}
+
+	sections := []section{}
+	for _, device := range devices {
+		deviceSection, err := readSection(r)
+		if err != nil {
+			return err
+		}
+		if deviceSection.name != fmt.Sprintf("%T", device) {
+			return fmt.Errorf("%w: found %s where %T should be", ErrWrongMachine, deviceSection.name, device)
+		}
+		sections = append(sections, deviceSection)
+	}
+
+	err = c.LoadState(bytes.NewReader(cpuSection.data))
+	if err != nil {
+		return err
+	}
+	for i, device := range devices {
+		err = device.LoadState(bytes.NewReader(sections[i].data))
+		if err != nil {
+			return fmt.Errorf("savestate: loading %s: %w", sections[i].name, err)
+		}
+	}
+
+	return nil
+}
+
+func SaveFile(path string, c *cpu.CPU) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = Save(file, c)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func LoadFile(path string, c *cpu.CPU) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return Load(file, c)
+}
@@ -0,0 +1,114 @@
+package savestate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/thatoddmailbox/computer-emu/bus"
+	"github.com/thatoddmailbox/computer-emu/cpu"
+	"github.com/thatoddmailbox/computer-emu/devices"
+)
+
+// newMachine creates a cpu with ram, a pio, and a uart on its bus, or the given devices instead
+func newMachine(memoryDevices ...bus.BusMemoryIODevice) *cpu.CPU {
+	c := &cpu.CPU{}
+	if len(memoryDevices) == 0 {
+		uart := devices.NewI8251()
+		// only what the test puts in should reach it, not whatever's on stdin
+		uart.SetReceiveHandler(func(b byte) {})
+		memoryDevices = []bus.BusMemoryIODevice{devices.NewKR537RU2(), devices.NewI8255(), uart}
+	}
+	c.Bus.MemoryDevices = append(c.Bus.MemoryDevices, memoryDevices...)
+	return c
+}
+
+func save(t *testing.T, c *cpu.CPU) []byte {
+	t.Helper()
+	saved := bytes.Buffer{}
+	err := Save(&saved, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return saved.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	c := newMachine()
+	ram := c.Bus.MemoryDevices[0].(*devices.KR537RU2)
+	pio := c.Bus.MemoryDevices[1].(*devices.I8255)
+	uart := c.Bus.MemoryDevices[2].(*devices.I8251)
+	ram.WriteByte(0xF005, 0x42)
+	pio.SetPortA(0x80)
+	uart.Receive('A')
+	c.Registers.A = 0x09
+	c.ShadowRegisters.H = 0x03
+	c.PC = 0x1234
+	c.IFF1 = true
+	c.Cycles = 99999
+
+	saved := save(t, c)
+
+	loaded := newMachine()
+	err := Load(bytes.NewReader(saved), loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.State() != c.State() {
+		t.Errorf("cpu was %+v after loading, expected %+v", loaded.State(), c.State())
+	}
+	if data := loaded.Bus.MemoryDevices[0].(*devices.KR537RU2).PeekByte(0xF005); data != 0x42 {
+		t.Errorf("0xF005 was 0x%02x after loading, expected 0x42", data)
+	}
+	if port := loaded.Bus.MemoryDevices[1].(*devices.I8255).GetPortA(); port != 0x80 {
+		t.Errorf("port A was 0x%02x after loading, expected 0x80", port)
+	}
+
+	// saving again should give exactly the same thing, including the byte waiting in the uart
+	if !bytes.Equal(save(t, loaded), saved) {
+		t.Errorf("saving after loading gave a different state")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	saved := save(t, newMachine())
+
+	wrongVersion := bytes.Buffer{}
+	binary.Write(&wrongVersion, binary.LittleEndian, &header{magic, Version + 1})
+	wrongVersion.Write(saved[binary.Size(header{}):])
+
+	tests := []struct {
+		name     string
+		saved    []byte
+		machine  *cpu.CPU
+		expected error
+	}{
+		{"not a save state", []byte("not a save state at all"), newMachine(), ErrNotSaveState},
+		{"newer version", wrongVersion.Bytes(), newMachine(), ErrWrongVersion},
+		{"fewer devices", saved, newMachine(devices.NewKR537RU2(), devices.NewI8255()), ErrWrongMachine},
+		{"more devices", saved, newMachine(devices.NewKR537RU2(), devices.NewI8255(), devices.NewI8251(), devices.NewAS6C62256()), ErrWrongMachine},
+		{"different device", saved, newMachine(devices.NewKR537RU2(), devices.NewI8251(), devices.NewI8255()), ErrWrongMachine},
+	}
+	for _, test := range tests {
+		test.machine.Registers.A = 0x55
+		test.machine.PC = 0x1234
+		ram := test.machine.Bus.MemoryDevices[0].(*devices.KR537RU2)
+		ram.WriteByte(0xF000, 0xAA)
+		before := test.machine.State()
+
+		err := Load(bytes.NewReader(test.saved), test.machine)
+		if !errors.Is(err, test.expected) {
+			t.Errorf("%s gave %v, expected %v", test.name, err, test.expected)
+		}
+
+		// nothing should have been loaded
+		if test.machine.State() != before {
+			t.Errorf("%s changed the cpu to %+v", test.name, test.machine.State())
+		}
+		if data := ram.PeekByte(0xF000); data != 0xAA {
+			t.Errorf("%s changed 0xF000 to 0x%02x", test.name, data)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Package symbols loads what the assembler knows about the firmware, so that addresses can be shown the way they are in the source.
+package symbols
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// a listing line starts with the address, then the bytes that were assembled there, then the source.
+// the bytes have to be separated from the source by a tab or at least two spaces, so that something like db isn't taken for a byte.
+var listingLinePattern = regexp.MustCompile(`^\s*([0-9A-Fa-f]{4})[:\s]\s*((?:[0-9A-Fa-f]{2})(?: [0-9A-Fa-f]{2})*)(?:\t|  |$)(.*)$`)
+
+// a label on a line of its own, which has an address but no bytes, or a constant, where the address is its value
+var listingLabelPattern = regexp.MustCompile(`^\s*([0-9A-Fa-f]{4})[:\s]\s*([A-Za-z_.@][\w.@]*)(:?)(?:\s+(\S+))?`)
+
+// directives that assemble data rather than instructions
+var dataDirectives = []string{"db", "dw", "ds", "defb", "defw", "defs", "defm", "byte", "word", "ascii", "asciz"}
+
+// ListingLine is a line of a listing that has bytes on it.
+type ListingLine struct {
+	// the line number in the listing file, starting from 1
+	Number int
+
+	Address uint16
+	Length  int
+
+	// the rest of the line, after the bytes
+	Source string
+}
+
+// IsData returns whether the line is a data directive, like db, instead of an instruction.
+func (l ListingLine) IsData() bool {
+	fields := strings.Fields(l.Source)
+	for _, field := range fields {
+		if strings.HasSuffix(field, ":") {
+			// a label
+			continue
+		}
+		directive := strings.ToLower(strings.TrimPrefix(field, "."))
+		for _, dataDirective := range dataDirectives {
+			if directive == dataDirective {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// Listing is an assembler listing, which maps addresses back to the lines they were assembled from.
+type Listing struct {
+	// where it was loaded from
+	Path string
+
+	Lines []ListingLine
+
+	// the labels defined in the listing, in the order they appear
+	Labels []Symbol
+
+	// names defined with an equ or similar, which aren't addresses
+	Constants []Symbol
+}
+
+// the label at the start of source, if there is one
+func sourceLabel(source string) (string, bool) {
+	fields := strings.Fields(source)
+	if len(fields) == 0 || !strings.HasSuffix(fields[0], ":") {
+		return "", false
+	}
+	name := strings.TrimSuffix(fields[0], ":")
+	return name, isIdentifier(name)
+}
+
+func ParseListing(r io.Reader, path string) (*Listing, error) {
+	listing := &Listing{
+		Path: path,
+	}
+
+	scanner := bufio.NewScanner(r)
+	number := 0
+	for scanner.Scan() {
+		number += 1
+		match := listingLinePattern.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			labelMatch := listingLabelPattern.FindStringSubmatch(scanner.Text())
+			if labelMatch != nil {
+				address, err := strconv.ParseUint(labelMatch[1], 16, 16)
+				if err != nil {
+					continue
+				}
+				if isAssignmentKeyword(labelMatch[4]) {
+					listing.Constants = append(listing.Constants, Symbol{labelMatch[2], uint16(address)})
+				} else if labelMatch[3] == ":" {
+					listing.Labels = append(listing.Labels, Symbol{labelMatch[2], uint16(address)})
+				}
+			}
+			continue
+		}
+
+		address, err := strconv.ParseUint(match[1], 16, 16)
+		if err != nil {
+			continue
+		}
+		line := ListingLine{
+			Number:  number,
+			Address: uint16(address),
+			Length:  len(strings.Fields(match[2])),
+			Source:  strings.TrimSpace(match[3]),
+		}
+		listing.Lines = append(listing.Lines, line)
+
+		label, ok := sourceLabel(line.Source)
+		if ok {
+			listing.Labels = append(listing.Labels, Symbol{label, line.Address})
+		}
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	return listing, nil
+}
+
+func LoadListing(path string) (*Listing, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseListing(file, path)
+}
+
+// Table returns the listing's labels as a symbol table.
+func (l *Listing) Table() *Table {
+	table := &Table{
+		Path:      l.Path,
+		Start:     0x0000,
+		End:       0xFFFF,
+		Symbols:   append([]Symbol{}, l.Labels...),
+		Constants: append([]Symbol{}, l.Constants...),
+	}
+	table.sort()
+	return table
+}
@@ -0,0 +1,256 @@
+package symbols
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Symbol is a label and the address it's at.
+type Symbol struct {
+	Name    string
+	Address uint16
+}
+
+// Table is the labels from one file. Since each ROM bank is assembled on its own, a table only applies to the addresses from Start to End.
+type Table struct {
+	// where it was loaded from
+	Path string
+
+	Start uint16
+	End   uint16
+
+	// sorted by address
+	Symbols []Symbol
+
+	// values from an equ that aren't addresses, like a buffer size, which can be looked up by name but aren't shown in place of addresses
+	Constants []Symbol
+}
+
+// Symbols is every table that's been loaded. A nil *Symbols has no labels, so addresses are shown as they are.
+type Symbols struct {
+	Tables []*Table
+}
+
+// keywords that can go between a label and its value
+var assignmentKeywords = []string{"equ", ".equ", "set", ".set", "defl"}
+
+func isAssignmentKeyword(token string) bool {
+	if token == "=" {
+		return true
+	}
+	for _, keyword := range assignmentKeywords {
+		if strings.ToLower(token) == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+// isAddressValue returns whether the value in an assignment is written the way z80asm writes the address of a label, like $1A3F.
+// Its symbol files are all equs, so this is the only way to tell an address from a constant.
+func isAddressValue(token string) bool {
+	if len(token) != 5 || token[0] != '$' {
+		return false
+	}
+	_, err := strconv.ParseUint(token[1:], 16, 16)
+	return err == nil
+}
+
+func isIdentifier(token string) bool {
+	if token == "" {
+		return false
+	}
+	for i, r := range token {
+		letter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '_' || r == '.' || r == '@'
+		digit := r >= '0' && r <= '9'
+		if !letter && !(digit && i > 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseNumber parses the ways an assembler might write an address. Plain numbers are decimal in an equ, but hex in a dump of addresses and labels.
+func parseNumber(token string, plainDecimal bool) (uint16, bool) {
+	lower := strings.ToLower(token)
+	base := 16
+	if strings.HasPrefix(lower, "0x") {
+		lower = lower[2:]
+	} else if strings.HasPrefix(lower, "$") {
+		lower = lower[1:]
+	} else if strings.HasSuffix(lower, "h") && lower[0] >= '0' && lower[0] <= '9' {
+		lower = lower[:len(lower)-1]
+	} else if lower[0] < '0' || lower[0] > '9' {
+		return 0, false
+	} else if plainDecimal {
+		base = 10
+	}
+
+	value, err := strconv.ParseUint(lower, base, 16)
+	if err != nil {
+		return 0, false
+	}
+	return uint16(value), true
+}
+
+// ParseTable reads a symbol file, with a label and its address on each line.
+// It understands the usual ways of writing one, like "label: equ 0x1234", "label = $1234", "label EQU 1234h", and "1234 label", and skips anything else.
+// Assignments go in Constants, unless the value is written like z80asm writes addresses, with a $ and four digits.
+func ParseTable(r io.Reader, path string) (*Table, error) {
+	table := &Table{
+		Path:  path,
+		Start: 0x0000,
+		End:   0xFFFF,
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		comment := strings.Index(line, ";")
+		if comment != -1 {
+			line = line[:comment]
+		}
+		line = strings.NewReplacer(":", " ", "=", " = ", ",", " ").Replace(line)
+
+		tokens := []string{}
+		assignment := false
+		for _, token := range strings.Fields(line) {
+			if isAssignmentKeyword(token) {
+				assignment = true
+				continue
+			}
+			tokens = append(tokens, token)
+		}
+		if len(tokens) != 2 {
+			continue
+		}
+
+		if address, ok := parseNumber(tokens[1], assignment); ok && isIdentifier(tokens[0]) {
+			if assignment && !isAddressValue(tokens[1]) {
+				table.Constants = append(table.Constants, Symbol{tokens[0], address})
+			} else {
+				table.Symbols = append(table.Symbols, Symbol{tokens[0], address})
+			}
+		} else if address, ok := parseNumber(tokens[0], assignment); ok && isIdentifier(tokens[1]) {
+			table.Symbols = append(table.Symbols, Symbol{tokens[1], address})
+		} else if address, err := strconv.ParseUint(tokens[1], 16, 16); err == nil && !assignment && isIdentifier(tokens[0]) {
+			// something like "start ABCD", where the address looks like a name
+			table.Symbols = append(table.Symbols, Symbol{tokens[0], uint16(address)})
+		}
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	table.sort()
+	return table, nil
+}
+
+func LoadTable(path string) (*Table, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseTable(file, path)
+}
+
+func (t *Table) sort() {
+	// stable, so that the first label at an address is the one that's shown
+	sort.SliceStable(t.Symbols, func(i, j int) bool {
+		return t.Symbols[i].Address < t.Symbols[j].Address
+	})
+}
+
+// lookup returns the closest symbol at or before address
+func (t *Table) lookup(address uint16) (Symbol, bool) {
+	if address < t.Start || address > t.End {
+		return Symbol{}, false
+	}
+
+	// the first symbol after address
+	i := sort.Search(len(t.Symbols), func(i int) bool {
+		return t.Symbols[i].Address > address
+	})
+	if i == 0 {
+		return Symbol{}, false
+	}
+	i -= 1
+
+	// go back to the first label at this address
+	for i > 0 && t.Symbols[i-1].Address == t.Symbols[i].Address {
+		i -= 1
+	}
+	if t.Symbols[i].Address < t.Start {
+		return Symbol{}, false
+	}
+	return t.Symbols[i], true
+}
+
+// Add adds a table. If more than one table covers an address, the one added first wins.
+func (s *Symbols) Add(table *Table) {
+	s.Tables = append(s.Tables, table)
+}
+
+// Lookup returns the closest label at or before address.
+func (s *Symbols) Lookup(address uint16) (Symbol, bool) {
+	if s == nil {
+		return Symbol{}, false
+	}
+	for _, table := range s.Tables {
+		symbol, ok := table.lookup(address)
+		if ok {
+			return symbol, true
+		}
+	}
+	return Symbol{}, false
+}
+
+// Label returns the label at exactly address, or an empty string if there isn't one.
+func (s *Symbols) Label(address uint16) string {
+	symbol, ok := s.Lookup(address)
+	if !ok || symbol.Address != address {
+		return ""
+	}
+	return symbol.Name
+}
+
+// Format returns address as label+offset, or as a plain hex number if there's no label before it.
+func (s *Symbols) Format(address uint16) string {
+	symbol, ok := s.Lookup(address)
+	if !ok {
+		return "0x" + strconv.FormatUint(uint64(address), 16)
+	}
+	if symbol.Address == address {
+		return symbol.Name
+	}
+	return fmt.Sprintf("%s+0x%x", symbol.Name, address-symbol.Address)
+}
+
+// Resolve returns the address of the given label, or the value of the given constant.
+func (s *Symbols) Resolve(name string) (uint16, bool) {
+	if s == nil {
+		return 0, false
+	}
+	for _, table := range s.Tables {
+		for _, symbol := range table.Symbols {
+			if symbol.Name == name {
+				return symbol.Address, true
+			}
+		}
+		for _, constant := range table.Constants {
+			if constant.Name == name {
+				return constant.Address, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,109 @@
+package symbols
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTable(t *testing.T) {
+	table, err := ParseTable(strings.NewReader(`; a comment
+start: equ $0000
+print_string = $1A3F
+loop EQU 1A50h
+0100 data_table
+main 0200
+count equ 16
+BUFSIZE equ 0x40
+not a symbol line
+`), "test.sym")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	symbols := map[string]uint16{"start": 0x0000, "print_string": 0x1A3F, "data_table": 0x0100, "main": 0x0200}
+	constants := map[string]uint16{"loop": 0x1A50, "count": 16, "BUFSIZE": 0x40}
+	if len(table.Symbols) != len(symbols) {
+		t.Errorf("table had %d symbols, expected %d", len(table.Symbols), len(symbols))
+	}
+	for _, symbol := range table.Symbols {
+		if address, ok := symbols[symbol.Name]; !ok || symbol.Address != address {
+			t.Errorf("symbol %s was 0x%04x, expected 0x%04x", symbol.Name, symbol.Address, address)
+		}
+	}
+	if len(table.Constants) != len(constants) {
+		t.Errorf("table had %d constants, expected %d", len(table.Constants), len(constants))
+	}
+	for _, constant := range table.Constants {
+		if value, ok := constants[constant.Name]; !ok || constant.Address != value {
+			t.Errorf("constant %s was 0x%04x, expected 0x%04x", constant.Name, constant.Address, value)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	table, err := ParseTable(strings.NewReader("start: equ $0000\nprint_string = $1A3F\n0100 data_table\nBUFSIZE equ 0x40\n"), "test.sym")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Symbols{}
+	s.Add(table)
+
+	tests := []struct {
+		address  uint16
+		expected string
+	}{
+		{0x1A3F, "print_string"},
+		{0x1A42, "print_string+0x3"},
+		{0x0100, "data_table"},
+		{0x0005, "start+0x5"},
+		// constants aren't shown in place of addresses
+		{0x0040, "start+0x40"},
+	}
+	for _, test := range tests {
+		if formatted := s.Format(test.address); formatted != test.expected {
+			t.Errorf("0x%04x was formatted as %s, expected %s", test.address, formatted, test.expected)
+		}
+	}
+
+	// but they can still be looked up by name
+	if value, ok := s.Resolve("BUFSIZE"); !ok || value != 0x40 {
+		t.Errorf("BUFSIZE resolved to 0x%04x, expected 0x0040", value)
+	}
+
+	var none *Symbols
+	if formatted := none.Format(0x1A3F); formatted != "0x1a3f" {
+		t.Errorf("0x1a3f was formatted as %s without symbols, expected 0x1a3f", formatted)
+	}
+}
+
+func TestBankedTables(t *testing.T) {
+	s := &Symbols{}
+	s.Add(&Table{Start: 0x1000, End: 0x1FFF, Symbols: []Symbol{{"bank1", 0x1000}}})
+	s.Add(&Table{Start: 0x0000, End: 0xFFFF, Symbols: []Symbol{{"zero", 0x0000}}})
+
+	if formatted := s.Format(0x1004); formatted != "bank1+0x4" {
+		t.Errorf("0x1004 was formatted as %s, expected bank1+0x4", formatted)
+	}
+	if formatted := s.Format(0x2000); formatted != "zero+0x2000" {
+		t.Errorf("0x2000 was formatted as %s, expected zero+0x2000", formatted)
+	}
+}
+
+func TestListingTable(t *testing.T) {
+	listing, err := ParseListing(strings.NewReader(`0040            BUFSIZE: equ 0x40
+0000            start:
+0000  3E 01     	ld a, 1
+0002  C9        done:	ret
+`), "test.lst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := listing.Table()
+
+	if len(table.Symbols) != 2 || table.Symbols[0] != (Symbol{"start", 0x0000}) || table.Symbols[1] != (Symbol{"done", 0x0002}) {
+		t.Errorf("listing symbols were %v, expected [{start 0} {done 2}]", table.Symbols)
+	}
+	if len(table.Constants) != 1 || table.Constants[0] != (Symbol{"BUFSIZE", 0x0040}) {
+		t.Errorf("listing constants were %v, expected [{BUFSIZE 64}]", table.Constants)
+	}
+}
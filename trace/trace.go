@@ -0,0 +1,200 @@
+// Package trace writes a line (or record) for each instruction the cpu runs, for following what the firmware did.
+package trace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/thatoddmailbox/computer-emu/cpu"
+)
+
+type FormatType int
+
+const (
+	// one line per instruction, with the disassembly
+	FormatText FormatType = iota
+
+	// a header, then a fixed size record per instruction, without the disassembly
+	FormatBinary
+)
+
+// Version is the version of the binary format, which comes after the magic in its header.
+const Version = 1
+
+var ErrUnknownFormat = errors.New("trace: unknown format")
+
+var binaryMagic = [8]byte{'C', 'E', 'M', 'U', 'T', 'R', 'C', 'E'}
+
+// RecordSize is the size of each record in the binary format:
+// pc (2 bytes), instruction length (1), instruction bytes (4, padded with zeroes), a, f, b, c, d, e, h, l (1 each),
+// sp, ix, iy (2 each), i, r (1 each), and the cycle count (8), all little endian.
+const RecordSize = 31
+
+// the longest instruction that's written out
+const maxInstructionLength = 4
+
+// Tracer writes out instructions before they run. It's only called when tracing is on, so it costs nothing otherwise.
+type Tracer struct {
+	Format FormatType
+
+	// only instructions with Start <= PC <= End are written
+	Start uint16
+	End   uint16
+
+	// if set, only instructions from when the cpu reaches Subroutine until it returns from it are written
+	Subroutine   *uint16
+	subroutineSP uint16
+	inSubroutine bool
+
+	// if set, nothing is written until a breakpoint is hit
+	FromBreakpoint bool
+	breakpointHit  bool
+
+	writer *bufio.Writer
+	record [RecordSize]byte
+}
+
+func NewTracer(w io.Writer, format FormatType) (*Tracer, error) {
+	if format != FormatText && format != FormatBinary {
+		return nil, ErrUnknownFormat
+	}
+	t := &Tracer{
+		Format: format,
+		Start:  0x0000,
+		End:    0xFFFF,
+		writer: bufio.NewWriter(w),
+	}
+
+	if format == FormatBinary {
+		err := binary.Write(t.writer, binary.LittleEndian, binaryMagic)
+		if err != nil {
+			return nil, err
+		}
+		err = binary.Write(t.writer, binary.LittleEndian, uint16(Version))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// BreakpointHit starts tracing, if it was waiting for a breakpoint.
+func (t *Tracer) BreakpointHit() {
+	t.breakpointHit = true
+}
+
+func (t *Tracer) shouldTrace(c *cpu.CPU) bool {
+	if t.FromBreakpoint && !t.breakpointHit {
+		return false
+	}
+
+	if t.Subroutine != nil {
+		if t.inSubroutine && int16(c.Registers.SP-t.subroutineSP) > 0 {
+			// the return address was popped, so it returned (the stack can wrap around to 0x0000)
+			t.inSubroutine = false
+		}
+		if !t.inSubroutine && c.PC == *t.Subroutine {
+			t.inSubroutine = true
+			t.subroutineSP = c.Registers.SP
+		}
+		if !t.inSubroutine {
+			return false
+		}
+	}
+
+	return (t.Start <= c.PC && c.PC <= t.End)
+}
+
+// Trace writes out the instruction at PC, along with the registers and cycle count from before it runs.
+// It should be called right before the cpu steps. If an interrupt is accepted instead, the interrupted instruction is what gets written.
+func (t *Tracer) Trace(c *cpu.CPU) error {
+	if c.Halted {
+		// it runs nops until an interrupt, which would be the same line over and over
+		return nil
+	}
+	if !t.shouldTrace(c) {
+		return nil
+	}
+
+	instruction := cpu.DisassembleAt(c, c.PC)
+	instructionBytes := [maxInstructionLength]byte{}
+	length := uint8(copy(instructionBytes[:], instruction.Bytes))
+
+	if t.Format == FormatBinary {
+		return t.writeRecord(c, instructionBytes, length)
+	}
+
+	label := c.Symbols.Label(c.PC)
+	if label != "" {
+		_, err := fmt.Fprintf(t.writer, "%s:\n", label)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(
+		t.writer,
+		"%04X  %-11s  %-20s  A=%02X F=%s B=%02X C=%02X D=%02X E=%02X H=%02X L=%02X SP=%04X IX=%04X IY=%04X  %d\n",
+		c.PC,
+		fmt.Sprintf("% X", instructionBytes[:length]),
+		instruction.Format(c.Symbols),
+		c.Registers.A,
+		formatFlags(c.Registers.Flag),
+		c.Registers.B,
+		c.Registers.C,
+		c.Registers.D,
+		c.Registers.E,
+		c.Registers.H,
+		c.Registers.L,
+		c.Registers.SP,
+		c.Registers.IX,
+		c.Registers.IY,
+		c.Cycles,
+	)
+	return err
+}
+
+// flags as letters, with a dot for the ones that are clear
+func formatFlags(flags uint8) string {
+	letters := "SZYHXPNC"
+	result := []byte("........")
+	for i := 0; i < 8; i++ {
+		if flags&(1<<uint(7-i)) != 0 {
+			result[i] = letters[i]
+		}
+	}
+	return string(result)
+}
+
+func (t *Tracer) writeRecord(c *cpu.CPU, instructionBytes [maxInstructionLength]byte, length uint8) error {
+	record := t.record[:]
+	binary.LittleEndian.PutUint16(record[0:], c.PC)
+	record[2] = length
+	copy(record[3:7], instructionBytes[:])
+	record[7] = c.Registers.A
+	record[8] = c.Registers.Flag
+	record[9] = c.Registers.B
+	record[10] = c.Registers.C
+	record[11] = c.Registers.D
+	record[12] = c.Registers.E
+	record[13] = c.Registers.H
+	record[14] = c.Registers.L
+	binary.LittleEndian.PutUint16(record[15:], c.Registers.SP)
+	binary.LittleEndian.PutUint16(record[17:], c.Registers.IX)
+	binary.LittleEndian.PutUint16(record[19:], c.Registers.IY)
+	record[21] = c.Registers.I
+	record[22] = c.Registers.R
+	binary.LittleEndian.PutUint64(record[23:], c.Cycles)
+
+	_, err := t.writer.Write(record)
+	return err
+}
+
+// Flush writes out anything that's buffered.
+func (t *Tracer) Flush() error {
+	return t.writer.Flush()
+}